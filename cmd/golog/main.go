@@ -0,0 +1,226 @@
+// Command golog re-renders golog output, in any of the formats the parse
+// package reads, in another format: plain text, key_value, json, console with
+// colors, or any other built-in one. The parse package reads text, key_value
+// and json lines only, so logfmt, pretty, ecs, cloud_logging, console and
+// template output is passed through as is.
+//
+//	kubectl logs -f deploy/api | golog
+//	golog -format json -follow /var/log/api.log
+//
+// Lines that aren't golog output, such as panics, are passed through as is,
+// unless -where narrows the output down to events matching a query, in the
+// language of the query package:
+//
+//	golog -where 'level>=WARN and id=db and latency_ms>200' api.log
+//
+// Usage:
+//
+//	golog [flags] [file ...]
+//
+// With no files, or -, it reads stdin. Flags:
+//
+//	-format string       output format, empty for LOG_ENCODING (default "console")
+//	-input string        input format: text, key_value or json, detected per line by default
+//	-prefix string       LOG_PREFIX text lines were written with
+//	-time-format string  output time format, as Config.TimeFormat
+//	-utc                 render timestamps in UTC rather than local time
+//	-where string        only show events matching this query
+//	-follow              keep reading files as they grow, like tail -f
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/timehop/golog/log"
+	"github.com/timehop/golog/log/parse"
+	"github.com/timehop/golog/log/query"
+)
+
+// pollInterval is how often a followed file is checked for more lines.
+const pollInterval = 250 * time.Millisecond
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("golog", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", string(log.ConsoleFormat), "output `format`, empty for LOG_ENCODING")
+	input := flags.String("input", "", "input `format`: text, key_value or json, detected per line by default")
+	prefix := flags.String("prefix", "", "LOG_PREFIX text lines were written with")
+	timeFormat := flags.String("time-format", "", "output time `format`, as Config.TimeFormat")
+	utc := flags.Bool("utc", false, "render timestamps in UTC rather than local time")
+	where := flags.String("where", "", "only show events matching this `query`")
+	follow := flags.Bool("follow", false, "keep reading files as they grow, like tail -f")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if f := log.LogFormat(*format); f != log.DefaultFormat && log.SanitizeFormat(f) != f {
+		fmt.Fprintf(stderr, "golog: unknown format %q\n", *format)
+		return 2
+	}
+	switch log.LogFormat(*input) {
+	case log.DefaultFormat, log.PlainTextFormat, log.KeyValueFormat, log.JsonFormat:
+	default:
+		fmt.Fprintf(stderr, "golog: unsupported input format %q, want text, key_value or json\n", *input)
+		return 2
+	}
+
+	var q *query.Query
+	if *where != "" {
+		var err error
+		if q, err = query.Parse(*where); err != nil {
+			fmt.Fprintf(stderr, "golog: %v\n", err)
+			return 2
+		}
+	}
+
+	conf := log.Config{Format: log.LogFormat(*format), TimeFormat: *timeFormat}
+	if *utc {
+		conf.TimeLocation = time.UTC
+	}
+	v := &viewer{
+		conf:      parse.Config{Format: log.LogFormat(*input), Prefix: *prefix},
+		where:     q,
+		formatter: log.NewFormatter(stdout, conf),
+		output:    stdout,
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		statusMu sync.Mutex
+		status   int
+	)
+	for _, path := range paths {
+		r, err := open(path, stdin, *follow)
+		if err != nil {
+			fmt.Fprintf(stderr, "golog: %v\n", err)
+			statusMu.Lock()
+			status = 1
+			statusMu.Unlock()
+			continue
+		}
+
+		view := func(path string, r io.ReadCloser) {
+			defer r.Close()
+			if err := v.view(r); err != nil {
+				fmt.Fprintf(stderr, "golog: %s: %v\n", path, err)
+				statusMu.Lock()
+				status = 1
+				statusMu.Unlock()
+			}
+		}
+		// Followed files never end, so they're read side by side.
+		if *follow {
+			wg.Add(1)
+			go func(path string, r io.ReadCloser) {
+				defer wg.Done()
+				view(path, r)
+			}(path, r)
+		} else {
+			view(path, r)
+		}
+	}
+	wg.Wait()
+	return status
+}
+
+// viewer renders lines read from its inputs to its output.
+type viewer struct {
+	conf parse.Config
+	// where, if set, drops the events it doesn't match, and other lines.
+	where     *query.Query
+	formatter log.Formatter
+
+	mu     sync.Mutex
+	output io.Writer
+}
+
+func (v *viewer) view(r io.Reader) error {
+	scanner := parse.NewScanner(r, v.conf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		e, err := scanner.Event()
+		switch {
+		case err != nil && v.where != nil:
+			// Lines that aren't events can't match a query.
+			continue
+		case err != nil:
+		case v.where != nil && !v.where.Match(e):
+			continue
+		default:
+			// Only text lines say which parts of the timestamp they had.
+			if e.Flags == log.FlagsNone && !e.Time.IsZero() {
+				e.Flags = log.FlagsDefault
+			}
+			line = v.formatter.Format(e)
+		}
+
+		v.mu.Lock()
+		_, err = io.WriteString(v.output, line+"\n")
+		v.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// open opens the file at path, or stdin for -, following it if asked.
+func open(path string, stdin io.Reader, follow bool) (io.ReadCloser, error) {
+	if path == "-" {
+		// A pipe is followed anyway: it only ends when the writer is done.
+		return io.NopCloser(stdin), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if follow {
+		return &followReader{file: file}, nil
+	}
+	return file, nil
+}
+
+// followReader reads a file as it grows, waiting for more at its end rather
+// than returning io.EOF. It starts over when the file is truncated, as when
+// it's rotated by copying and truncating it.
+type followReader struct {
+	file   *os.File
+	offset int64
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		r.offset += int64(n)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		time.Sleep(pollInterval)
+		if info, err := r.file.Stat(); err == nil && info.Size() < r.offset {
+			if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			r.offset = 0
+		}
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const input = `{"ts":"2009-01-23T01:23:23Z","lvl":"WARN","msg":"Slow query.","fields":{"golog_id":"db","ms":"250"}}
+timestamp='1232673803' level='INFO' channel='Golog' message='Started.' port='8080'
+panic: oops
+`
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{
+			[]string{"-format", "text", "-time-format", "15:04:05", "-utc"},
+			"01:23:23 | WARN | db | Slow query. | ms='250'\n01:23:23 | INFO | Started. | port='8080'\npanic: oops\n",
+		},
+		{
+			[]string{"-format", "key_value"},
+			"timestamp='1232673803' level='WARN' channel='db' message='Slow query.' ms='250'\n" +
+				"timestamp='1232673803' level='INFO' channel='Golog' message='Started.' port='8080'\npanic: oops\n",
+		},
+		{
+			[]string{"-format", "key_value", "-where", "level>=WARN or port<1024"},
+			"timestamp='1232673803' level='WARN' channel='db' message='Slow query.' ms='250'\n",
+		},
+		{
+			[]string{"-format", "text", "-input", "key_value", "-time-format", "epoch"},
+			"{\"ts\":\"2009-01-23T01:23:23Z\",\"lvl\":\"WARN\",\"msg\":\"Slow query.\",\"fields\":{\"golog_id\":\"db\",\"ms\":\"250\"}}\n" +
+				"1232673803 | INFO | Started. | port='8080'\npanic: oops\n",
+		},
+	} {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if status := run(test.args, strings.NewReader(input), stdout, stderr); status != 0 {
+			t.Errorf("%v: got status %d: %s", test.args, status, stderr)
+		}
+		if stdout.String() != test.want {
+			t.Errorf("%v: got %q, want %q", test.args, stdout, test.want)
+		}
+	}
+}
+
+func TestRunDefaultFormat(t *testing.T) {
+	t.Setenv("LOG_ENCODING", "key_value")
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if status := run([]string{"-format", ""}, strings.NewReader("INFO | Started.\n"), stdout, stderr); status != 0 {
+		t.Fatalf("got status %d: %s", status, stderr)
+	}
+	if !strings.Contains(stdout.String(), "level='INFO' channel='Golog' message='Started.'") {
+		t.Errorf("got %q, want key_value from LOG_ENCODING", stdout)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-format", "xml"},
+		{"-input", "console"},
+		{"-input", "logfmt"},
+		{"-where", "level>="},
+		{"-nope"},
+	} {
+		if status := run(args, strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)); status != 2 {
+			t.Errorf("%v: got status %d, want 2", args, status)
+		}
+	}
+
+	stderr := new(bytes.Buffer)
+	if status := run([]string{filepath.Join(t.TempDir(), "missing.log")}, nil, new(bytes.Buffer), stderr); status != 1 {
+		t.Errorf("got status %d for a missing file, want 1", status)
+	}
+	if !strings.Contains(stderr.String(), "missing.log") {
+		t.Errorf("got %q, want the missing file named", stderr)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while golog writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.log")
+	if err := os.WriteFile(path, []byte("INFO | Started.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(syncBuffer)
+	go run([]string{"-format", "key_value", "-follow", path}, nil, stdout, new(bytes.Buffer))
+
+	waitFor := func(want string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !strings.Contains(stdout.String(), want); {
+			if time.Now().After(deadline) {
+				t.Fatalf("got %q, want %q", stdout, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("message='Started.'")
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("WARN | Slow")
+	file.WriteString(" query.\n")
+	file.Close()
+	waitFor("message='Slow query.'")
+
+	// Truncated, as when rotated by copying.
+	if err := os.WriteFile(path, []byte("ERROR | Restarted.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("message='Restarted.'")
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cloudLoggingSeverities maps levels to Cloud Logging severities.
+var cloudLoggingSeverities = map[LogLevelName]string{
+	LevelTraceName: "DEBUG",
+	LevelDebugName: "DEBUG",
+	LevelInfoName:  "INFO",
+	LevelWarnName:  "WARNING",
+	LevelErrorName: "ERROR",
+	LevelFatalName: "CRITICAL",
+}
+
+const (
+	cloudLoggingSourceLocation = "logging.googleapis.com/sourceLocation"
+	cloudLoggingLabels         = "logging.googleapis.com/labels"
+	cloudLoggingTrace          = "logging.googleapis.com/trace"
+	cloudLoggingSpanID         = "logging.googleapis.com/spanId"
+	cloudLoggingTraceSampled   = "logging.googleapis.com/trace_sampled"
+)
+
+// cloudLoggingFormatter returns a formatter writing events as the structured
+// JSON Cloud Logging parses from the stdout of Cloud Run, GKE and App Engine:
+//
+//	{"severity":"ERROR","message":"Could not connect.","time":"2014-06-01T15:04:05.123456789Z","url":"http://timehop.com/","logging.googleapis.com/labels":{"golog_id":"db"},"logging.googleapis.com/sourceLocation":{"file":"main.go","line":"12"}}
+//
+// The golog_id and static fields are sent as labels, and the caller as the
+// source location. A trace_id field, static or not, along with span_id and
+// trace_sampled, correlates the entry with its trace in project, when known. Fields and labels
+// follow the logger's field order.
+func cloudLoggingFormatter(project string) Formatter {
+	return FormatterFunc(func(e Event) string {
+		entry := newJsonObject()
+		entry.set("severity", cloudLoggingSeverities[e.Level])
+		entry.set("message", e.Message)
+		entry.set("time", e.Time.UTC().Format(time.RFC3339Nano))
+
+		// Static fields are sent as labels, unless Cloud Logging reads them or
+		// the call overrides them.
+		callSite := make(map[string]bool, len(e.KeysAndValues)/2)
+		for i := 0; i+1 < len(e.KeysAndValues); i += 2 {
+			callSite[fmt.Sprintf("%v", e.KeysAndValues[i])] = true
+		}
+
+		labels := newJsonObject()
+		sourceLocation := newJsonObject()
+		for _, f := range e.Fields() {
+			switch f.Key {
+			case "golog_id":
+				labels.set(f.Key, f.Value)
+			case "file", "line":
+				sourceLocation.set(f.Key, f.Value)
+			case "trace_id":
+				if project != "" {
+					entry.set(cloudLoggingTrace, "projects/"+project+"/traces/"+f.Value)
+				} else {
+					entry.set(cloudLoggingTrace, f.Value)
+				}
+			case "span_id":
+				entry.set(cloudLoggingSpanID, f.Value)
+			case "trace_sampled":
+				if sampled, err := strconv.ParseBool(f.Value); err == nil {
+					entry.set(cloudLoggingTraceSampled, sampled)
+					break
+				}
+				entry.set(f.Key, f.Value)
+			default:
+				switch {
+				case !callSite[f.Key]:
+					labels.set(f.Key, f.Value)
+				case isCloudLoggingKey(f.Key):
+					entry.set(f.Key+"_", f.Value)
+				default:
+					entry.set(f.Key, f.Value)
+				}
+			}
+		}
+
+		if labels.len() > 0 {
+			entry.set(cloudLoggingLabels, labels)
+		}
+		if sourceLocation.len() > 0 {
+			entry.set(cloudLoggingSourceLocation, sourceLocation)
+		}
+		return entry.String()
+	})
+}
+
+// isCloudLoggingKey reports whether key is one Cloud Logging gives a meaning
+// to.
+func isCloudLoggingKey(key string) bool {
+	switch key {
+	case "severity", "message", "time":
+		return true
+	}
+	return strings.HasPrefix(key, "logging.googleapis.com/")
+}
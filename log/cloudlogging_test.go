@@ -0,0 +1,127 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func decodeCloudLogging(t *testing.T, line string) map[string]any {
+	t.Helper()
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return entry
+}
+
+func TestCloudLoggingFormat(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("writes the special keys", func(t *testing.T) {
+		format := cloudLoggingFormatter("my-project")
+		entry := decodeCloudLogging(t, format.Format(testEvent(0, LevelErrorName, "Could not connect.", []Field{{"env", "prod"}},
+			"golog_id", "db", "url", "http://timehop.com/", "file", "main.go", "line", "12",
+			"trace_id", "4bf92f3577b34da6a3ce929d0e0e4736", "span_id", "00f067aa0ba902b7", "trace_sampled", "true")))
+
+		for key, want := range map[string]any{
+			"severity":                             "ERROR",
+			"message":                              "Could not connect.",
+			"url":                                  "http://timehop.com/",
+			"logging.googleapis.com/trace":         "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			"logging.googleapis.com/spanId":        "00f067aa0ba902b7",
+			"logging.googleapis.com/trace_sampled": true,
+		} {
+			if entry[key] != want {
+				t.Errorf("%s: got %v, want %v", key, entry[key], want)
+			}
+		}
+
+		labels, _ := entry["logging.googleapis.com/labels"].(map[string]any)
+		if len(labels) != 2 || labels["env"] != "prod" || labels["golog_id"] != "db" {
+			t.Errorf("unexpected labels %v", labels)
+		}
+		location, _ := entry["logging.googleapis.com/sourceLocation"].(map[string]any)
+		if len(location) != 2 || location["file"] != "main.go" || location["line"] != "12" {
+			t.Errorf("unexpected source location %v", location)
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil || time.Since(ts) > time.Minute {
+			t.Errorf("unexpected time %v: %v", entry["time"], err)
+		}
+	})
+
+	t.Run("maps every level to a severity", func(t *testing.T) {
+		format := cloudLoggingFormatter("")
+		for level, want := range map[LogLevelName]string{
+			LevelTraceName: "DEBUG", LevelDebugName: "DEBUG", LevelInfoName: "INFO",
+			LevelWarnName: "WARNING", LevelErrorName: "ERROR", LevelFatalName: "CRITICAL",
+		} {
+			if got := decodeCloudLogging(t, format.Format(testEvent(0, level, "msg", nil)))["severity"]; got != want {
+				t.Errorf("%s: got %v, want %v", level, got, want)
+			}
+		}
+	})
+
+	t.Run("sends bare trace ids without a project", func(t *testing.T) {
+		entry := decodeCloudLogging(t, cloudLoggingFormatter("").Format(testEvent(0, LevelInfoName, "msg", nil, "trace_id", "abc")))
+		if got := entry["logging.googleapis.com/trace"]; got != "abc" {
+			t.Errorf("got %v, want abc", got)
+		}
+	})
+
+	t.Run("keeps fields from overriding special keys", func(t *testing.T) {
+		entry := decodeCloudLogging(t, cloudLoggingFormatter("").Format(testEvent(0, LevelInfoName, "msg", []Field{{"user", "static"}},
+			"severity", "EMERGENCY", "message", "fake", "logging.googleapis.com/labels", "x", "user", "bilbo")))
+
+		for key, want := range map[string]any{
+			"severity":                       "INFO",
+			"message":                        "msg",
+			"severity_":                      "EMERGENCY",
+			"message_":                       "fake",
+			"logging.googleapis.com/labels_": "x",
+			"user":                           "bilbo",
+		} {
+			if entry[key] != want {
+				t.Errorf("%s: got %v, want %v", key, entry[key], want)
+			}
+		}
+		if _, ok := entry["logging.googleapis.com/labels"]; ok {
+			t.Errorf("static field overridden at the call site still sent as a label: %v", entry)
+		}
+	})
+
+	t.Run("correlates static trace ids", func(t *testing.T) {
+		entry := decodeCloudLogging(t, cloudLoggingFormatter("p").Format(testEvent(0, LevelInfoName, "msg",
+			[]Field{{"trace_id", "abc"}, {"span_id", "def"}, {"file", "static.go"}, {"env", "prod"}}, "file", "main.go")))
+
+		if got := entry["logging.googleapis.com/trace"]; got != "projects/p/traces/abc" {
+			t.Errorf("got trace %v", got)
+		}
+		if got := entry["logging.googleapis.com/spanId"]; got != "def" {
+			t.Errorf("got span id %v", got)
+		}
+		if labels, _ := entry["logging.googleapis.com/labels"].(map[string]any); len(labels) != 1 || labels["env"] != "prod" {
+			t.Errorf("got labels %v, want only env", labels)
+		}
+		if location, _ := entry["logging.googleapis.com/sourceLocation"].(map[string]any); location["file"] != "main.go" {
+			t.Errorf("got source location %v, want the call's file", location)
+		}
+	})
+
+	t.Run("reads the project from the environment", func(t *testing.T) {
+		t.Setenv("GOOGLE_CLOUD_PROJECT", "env-project")
+		t.Setenv("LOG_PREFIX", "app")
+		initLogging()
+		output := new(bytes.Buffer)
+		New(Config{Sinks: []Sink{NewSink(output, CloudLoggingFormat)}}).Info("msg", "trace_id", "abc")
+
+		entry := decodeCloudLogging(t, output.String())
+		if got := entry["logging.googleapis.com/trace"]; got != "projects/env-project/traces/abc" {
+			t.Errorf("got %v", got)
+		}
+		if labels, _ := entry["logging.googleapis.com/labels"].(map[string]any); labels["prefix"] != "app" {
+			t.Errorf("got labels %v, want the prefix", labels)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+
+	// consoleIDWidth is the width ids are padded to, so that descriptions
+	// line up.
+	consoleIDWidth = 12
+)
+
+var levelColors = map[LogLevelName]string{
+	LevelFatalName: ansiBold + ansiMagenta,
+	LevelErrorName: ansiBold + ansiRed,
+	LevelWarnName:  ansiYellow,
+	LevelInfoName:  ansiGreen,
+	LevelDebugName: ansiBlue,
+	LevelTraceName: ansiDim,
+}
+
+// colorEnabled reports whether console output to w should be colored: only
+// when w is a terminal, and NO_COLOR isn't set.
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	return ok && isTerminal(file.Fd())
+}
+
+// formatLogEventAsConsole formats an event for reading in a terminal:
+//
+//	15:04:05 INFO  db           Connected. host=localhost:5432 logging.go:42
+//
+// with a colored level, a dimmed timestamp and caller, and highlighted keys.
+// The timestamp follows the stdlib log flags, unless Config sets a time format,
+// and the sink doesn't pass them on to its logger.
+func (o formatOptions) formatLogEventAsConsole(e Event) string {
+	fields := e.Fields()
+	id, fields := popField(fields, "golog_id")
+	file, fields := popField(fields, "file")
+	line, fields := popField(fields, "line")
+
+	var b strings.Builder
+	if ts := o.textTimestamp(e.Flags, e.Time); ts != "" {
+		b.WriteString(ansiDim + ts + ansiReset + " ")
+	}
+
+	b.WriteString(levelColors[e.Level] + fmt.Sprintf("%-5s", e.Level) + ansiReset + " ")
+
+	id = escapeConsoleText(id)
+	b.WriteString(ansiBold + id + ansiReset)
+	if pad := consoleIDWidth - utf8.RuneCountInString(id); pad > 0 {
+		b.WriteString(strings.Repeat(" ", pad))
+	}
+
+	b.WriteString(" " + escapeConsoleText(e.Message))
+
+	for _, f := range fields {
+		b.WriteString(" " + ansiCyan + logfmtKey(f.Key) + ansiReset + "=" + logfmtValue(f.Value))
+	}
+
+	if file != "" {
+		b.WriteString(" " + ansiDim + escapeConsoleText(file) + ":" + escapeConsoleText(line) + ansiReset)
+	}
+	return b.String()
+}
+
+// escapeConsoleText keeps text to a single line and out of the terminal's
+// control: the console format has no separators to protect, so only
+// backslashes, control characters and ANSI sequences are escaped.
+func escapeConsoleText(s string) string {
+	return escapeText(s, `\`)
+}
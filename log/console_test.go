@@ -0,0 +1,60 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("colors levels, ids, keys and caller", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsConsole(testEvent(0, LevelErrorName, "Could not connect.", []Field{{"golog_id", "db"}},
+			"url", "http://timehop.com/", "error", "timed out", "file", "main.go", "line", "12"))
+		want := "\x1b[1m\x1b[31mERROR\x1b[0m \x1b[1mdb\x1b[0m           Could not connect." +
+			" \x1b[36murl\x1b[0m=http://timehop.com/ \x1b[36merror\x1b[0m=\"timed out\"" +
+			" \x1b[2mmain.go:12\x1b[0m"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("aligns descriptions", func(t *testing.T) {
+		withID := stripANSI(formatOptions{}.formatLogEventAsConsole(testEvent(0, LevelInfoName, "one", nil, "golog_id", "app")))
+		withoutID := stripANSI(formatOptions{}.formatLogEventAsConsole(testEvent(0, LevelWarnName, "two", nil)))
+		if strings.Index(withID, "one") != strings.Index(withoutID, "two") {
+			t.Errorf("descriptions not aligned:\n%s\n%s", withID, withoutID)
+		}
+	})
+
+	t.Run("strips escape sequences from input", func(t *testing.T) {
+		got := stripANSI(formatOptions{}.formatLogEventAsConsole(testEvent(0, LevelInfoName, "\x1b[31mred\x1b[0m\n", nil, "k", "\x1b[2J")))
+		if want := "INFO               red\\n k=\"\\u001b[2J\""; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("falls back to plain text when not a terminal", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		logger := New(Config{Format: ConsoleFormat, ID: "id"})
+		logger.SetOutput(output)
+		logger.Info("msg", "k", "v")
+
+		if got, want := output.String(), "INFO | id | msg | k='v'\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("is read from LOG_ENCODING", func(t *testing.T) {
+		t.Setenv("LOG_ENCODING", "console")
+		if got := SanitizeFormat(DefaultFormat); got != ConsoleFormat {
+			t.Errorf("got %q, want %q", got, ConsoleFormat)
+		}
+	})
+}
+
+func stripANSI(s string) string {
+	return ansiSequence.ReplaceAllString(s, "")
+}
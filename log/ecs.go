@@ -0,0 +1,135 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ecsVersion is the Elastic Common Schema version EcsFormat follows.
+const ecsVersion = "8.11.0"
+
+// formatLogEventAsEcs formats an event as an Elastic Common Schema document:
+//
+//	{"@timestamp":"2014-06-01T15:04:05.000Z","log.level":"error","message":"Could not connect.","ecs.version":"8.11.0","log":{"logger":"db"},"error":{"message":"timed out"},"labels":{"url":"http://timehop.com/"}}
+//
+// The golog_id is sent as log.logger, the caller as log.origin.file, and the
+// error and stack_trace fields as error.message and error.stack_trace. Fields
+// with a dotted key, like http.request.method, are nested by path, and every
+// other field is sent as a label, all in the logger's field order.
+func formatLogEventAsEcs(e Event) string {
+	fields := e.Fields()
+	id, fields := popField(fields, "golog_id")
+	file, fields := popField(fields, "file")
+	line, fields := popField(fields, "line")
+	errorMessage, fields := popField(fields, "error")
+	stackTrace, fields := popField(fields, "stack_trace")
+
+	// The ECS logging spec wants @timestamp, log.level and message first.
+	doc := newJsonObject()
+	doc.set("@timestamp", e.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	doc.set("log.level", strings.ToLower(string(e.Level)))
+	doc.set("message", e.Message)
+	doc.set("ecs.version", ecsVersion)
+
+	labels := newJsonObject()
+	if id != "" {
+		setEcsField(doc, []string{"log", "logger"}, id)
+	}
+	if file != "" {
+		setEcsField(doc, []string{"log", "origin", "file", "name"}, file)
+	}
+	if n, err := strconv.Atoi(line); err == nil {
+		setEcsField(doc, []string{"log", "origin", "file", "line"}, n)
+	} else if line != "" {
+		labels.set("line", line)
+	}
+	if errorMessage != "" {
+		setEcsField(doc, []string{"error", "message"}, errorMessage)
+	}
+	if stackTrace != "" {
+		setEcsField(doc, []string{"error", "stack_trace"}, stackTrace)
+	}
+
+	for _, f := range fields {
+		path := ecsPath(f.Key)
+		if len(path) == 2 && path[0] == "labels" {
+			labels.set(path[1], f.Value)
+		} else if path == nil || !setEcsField(doc, path, f.Value) {
+			labels.set(ecsFieldName(f.Key), f.Value)
+		}
+	}
+	if labels.len() > 0 {
+		doc.set("labels", labels)
+	}
+	return doc.String()
+}
+
+// ecsPath splits a dotted key into a field path, or returns nil if the key
+// isn't dotted or would clash with the fields every document holds.
+func ecsPath(key string) []string {
+	if !strings.Contains(key, ".") {
+		return nil
+	}
+
+	path := strings.Split(key, ".")
+	for i, segment := range path {
+		if path[i] = ecsFieldName(segment); segment == "" {
+			return nil
+		}
+	}
+
+	switch path[0] {
+	case "message", "_timestamp":
+		return nil
+	case "labels":
+		if len(path) != 2 {
+			return nil
+		}
+	case "log":
+		if path[1] == "level" {
+			return nil
+		}
+	case "ecs":
+		if path[1] == "version" {
+			return nil
+		}
+	}
+	return path
+}
+
+// setEcsField sets the field at path, unless it's already set or one of its
+// parents isn't an object.
+func setEcsField(doc *jsonObject, path []string, value any) bool {
+	for _, name := range path[:len(path)-1] {
+		child, ok := doc.get(name)
+		if !ok {
+			child = newJsonObject()
+			doc.set(name, child)
+		}
+		if doc, ok = child.(*jsonObject); !ok {
+			return false
+		}
+	}
+
+	name := path[len(path)-1]
+	if _, ok := doc.get(name); ok {
+		return false
+	}
+	doc.set(name, value)
+	return true
+}
+
+// ecsFieldName makes name follow the ECS naming rules: lowercase letters,
+// digits and underscores.
+func ecsFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '_'
+		}
+	}, name)
+}
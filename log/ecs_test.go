@@ -0,0 +1,149 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	ecsFieldNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+	ecsHeaderPattern    = regexp.MustCompile(`^\{"@timestamp":"[^"]*","log\.level":"[^"]*","message":`)
+)
+
+// validateEcs checks a document against the ECS logging rules: @timestamp,
+// log.level and message first, ecs.version set, a UTC timestamp, lowercase
+// field names, and labels holding only undotted string keywords.
+func validateEcs(t *testing.T, line string) map[string]any {
+	t.Helper()
+
+	if !ecsHeaderPattern.MatchString(line) {
+		t.Errorf("%s doesn't start with @timestamp, log.level and message", line)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(line), &doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if doc["ecs.version"] != ecsVersion {
+		t.Errorf("got ecs.version %v, want %q", doc["ecs.version"], ecsVersion)
+	}
+	timestamp, _ := doc["@timestamp"].(string)
+	if ts, err := time.Parse(time.RFC3339Nano, timestamp); err != nil || !strings.HasSuffix(timestamp, "Z") {
+		t.Errorf("@timestamp %q isn't a UTC RFC 3339 timestamp: %v", timestamp, err)
+	} else if time.Since(ts) > time.Minute {
+		t.Errorf("@timestamp %q isn't now", timestamp)
+	}
+
+	if labels, ok := doc["labels"]; ok {
+		labelMap, ok := labels.(map[string]any)
+		if !ok {
+			t.Fatalf("labels %v isn't an object", labels)
+		}
+		for key, value := range labelMap {
+			if _, ok := value.(string); !ok || !ecsFieldNamePattern.MatchString(key) {
+				t.Errorf("label %q=%v isn't an undotted keyword", key, value)
+			}
+		}
+	}
+
+	var walk func(prefix string, object map[string]any)
+	walk = func(prefix string, object map[string]any) {
+		for key, value := range object {
+			if prefix == "" && (key == "@timestamp" || key == "log.level" || key == "ecs.version") {
+				continue
+			}
+			if !ecsFieldNamePattern.MatchString(key) {
+				t.Errorf("field %q isn't a valid ECS name", prefix+key)
+			}
+			if child, ok := value.(map[string]any); ok {
+				walk(prefix+key+".", child)
+			}
+		}
+	}
+	walk("", doc)
+	return doc
+}
+
+func ecsField(doc map[string]any, path string) any {
+	var value any = doc
+	for _, name := range strings.Split(path, ".") {
+		object, _ := value.(map[string]any)
+		value = object[name]
+	}
+	return value
+}
+
+func TestEcsFormat(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("maps golog fields to ECS", func(t *testing.T) {
+		line := formatLogEventAsEcs(testEvent(0, LevelErrorName, "Could not connect.", []Field{{"golog_id", "db"}},
+			"error", "timed out", "stack_trace", "main.main()", "url", "http://timehop.com/", "file", "main.go", "line", "12"))
+		doc := validateEcs(t, line)
+
+		for path, want := range map[string]any{
+			"message":              "Could not connect.",
+			"log.logger":           "db",
+			"log.origin.file.name": "main.go",
+			"log.origin.file.line": float64(12),
+			"error.message":        "timed out",
+			"error.stack_trace":    "main.main()",
+			"labels.url":           "http://timehop.com/",
+		} {
+			if got := ecsField(doc, path); got != want {
+				t.Errorf("%s: got %v, want %v", path, got, want)
+			}
+		}
+		if doc["log.level"] != "error" {
+			t.Errorf("got log.level %v, want error", doc["log.level"])
+		}
+	})
+
+	t.Run("nests dotted keys", func(t *testing.T) {
+		doc := validateEcs(t, formatLogEventAsEcs(testEvent(0, LevelInfoName, "msg", nil,
+			"http.request.method", "GET", "User.ID", "42", "labels.env", "prod")))
+
+		for path, want := range map[string]any{
+			"http.request.method": "GET",
+			"user.id":             "42",
+			"labels.env":          "prod",
+		} {
+			if got := ecsField(doc, path); got != want {
+				t.Errorf("%s: got %v, want %v", path, got, want)
+			}
+		}
+	})
+
+	t.Run("keeps clashing keys as labels", func(t *testing.T) {
+		doc := validateEcs(t, formatLogEventAsEcs(testEvent(0, LevelInfoName, "msg", []Field{{"golog_id", "id"}},
+			"log.level", "x", "message.text", "x", "log.logger", "x", "log.logger.name", "x",
+			"ecs.version", "x", "labels.a.b", "x", "a..b", "x", "@timestamp", "x", "Camel Case", "x")))
+
+		labels, _ := doc["labels"].(map[string]any)
+		for _, key := range []string{"log_level", "message_text", "log_logger", "log_logger_name", "ecs_version", "labels_a_b", "a__b", "_timestamp", "camel_case"} {
+			if labels[key] != "x" {
+				t.Errorf("missing label %q in %v", key, labels)
+			}
+		}
+		if doc["log.level"] != "info" || doc["message"] != "msg" || ecsField(doc, "log.logger") != "id" {
+			t.Errorf("reserved fields were overridden: %v", doc)
+		}
+	})
+
+	t.Run("writes the prefix as a label", func(t *testing.T) {
+		t.Setenv("LOG_PREFIX", "app")
+		initLogging()
+		output := new(bytes.Buffer)
+		New(Config{Sinks: []Sink{NewSink(output, EcsFormat)}}).Info("msg")
+
+		doc := validateEcs(t, strings.TrimSuffix(output.String(), "\n"))
+		if got := ecsField(doc, "labels.prefix"); got != "app" {
+			t.Errorf("got %v, want app", got)
+		}
+	})
+}
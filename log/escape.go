@@ -0,0 +1,73 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Escaping for the text formats, following the grammar in the package doc.
+
+// ansiSequence matches CSI sequences (colors, cursor movement), OSC sequences
+// (window titles, hyperlinks) and two-character escapes.
+var ansiSequence = regexp.MustCompile("(\x1b\\[|\u009b)[0-?]*[ -/]*[@-~]|(\x1b\\]|\u009d)[^\x07\x1b\u009c]*(\x07|\x1b\\\\|\u009c)?|\x1b[@-Z\\\\-_]")
+
+// escapeTextValue escapes a quoted value.
+func escapeTextValue(s string) string {
+	return escapeText(s, `\'`)
+}
+
+// escapeTextSegment escapes an id or description.
+func escapeTextSegment(s string) string {
+	return escapeText(s, `\|`)
+}
+
+// escapeText removes ANSI sequences from s, and escapes non-printable
+// characters and any of specials.
+func escapeText(s string, specials string) string {
+	if strings.IndexFunc(s, func(r rune) bool {
+		return strings.ContainsRune(specials, r) || r == utf8.RuneError || !unicode.IsPrint(r)
+	}) < 0 {
+		return s
+	}
+
+	s = ansiSequence.ReplaceAllString(s, "")
+
+	var escaped strings.Builder
+	for i, r := range s {
+		switch {
+		case r == utf8.RuneError && !strings.HasPrefix(s[i:], "\uFFFD"):
+			fmt.Fprintf(&escaped, `\x%02x`, s[i])
+		case strings.ContainsRune(specials, r):
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		case r == '\n':
+			escaped.WriteString(`\n`)
+		case r == '\r':
+			escaped.WriteString(`\r`)
+		case r == '\t':
+			escaped.WriteString(`\t`)
+		case r < 0x80 && !unicode.IsPrint(r):
+			fmt.Fprintf(&escaped, `\x%02x`, r)
+		case !unicode.IsPrint(r) && r > 0xffff:
+			fmt.Fprintf(&escaped, `\U%08x`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&escaped, `\u%04x`, r)
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+// escapeTextKey replaces the characters a key can't hold with underscores.
+func escapeTextKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '=' || r == '\'' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
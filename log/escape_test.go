@@ -0,0 +1,149 @@
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/timehop/golog/log/internal/textformat"
+)
+
+func TestEscaping(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("values can't forge fields", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPlainText(testEvent(0, LevelInfoName, "msg", nil, "user", "x' admin='true"))
+		if want := `INFO | msg | user='x\' admin=\'true'`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("values can't fake lines", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPlainText(testEvent(0, LevelInfoName, "msg", nil, "user", "bilbo'\nERROR | fake | pwned"))
+		if want := `INFO | msg | user='bilbo\'\nERROR | fake | pwned'`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("descriptions and ids can't fake segments", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPlainText(testEvent(0, LevelInfoName, "a | b\\c\r\n", nil, "golog_id", "x|y"))
+		if want := `INFO | x\|y | a \| b\\c\r\n`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("strips ANSI sequences", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPlainText(testEvent(0, LevelInfoName, "\x1b[31mred\x1b[0m", nil,
+			"title", "\x1b]0;pwned\x07ok", "lone", "\x1b"))
+		if want := `INFO | red | title='ok' lone='\x1b'`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("escapes control characters and invalid UTF-8", func(t *testing.T) {
+		got := escapeTextValue("\x00\x7f\u0085\xff\t🎉\U000e0001")
+		if want := `\x00\x7f\u0085\xff\t🎉\U000e0001`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("sanitizes keys", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPlainText(testEvent(0, LevelInfoName, "msg", nil, "a b='c\n", "v"))
+		if want := `INFO | msg | a_b__c_='v'`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("escapes key value format", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsKeyValue(testEvent(0, LevelInfoName, "it's\n", nil, "golog_id", "a'b", "k", "v'"))
+		want := ` level='INFO' channel='a\'b' message='it\'s\n' k='v\''`
+		if got[strings.IndexByte(got, ' '):] != want {
+			t.Errorf("got %q, want suffix %q", got, want)
+		}
+	})
+}
+
+func FuzzPlainTextSingleLine(f *testing.F) {
+	f.Add("id", "description", "key", "value")
+	f.Add("", "a | b", "x' admin='true", "bilbo'\nERROR | fake | pwned")
+	f.Add("\x1b[2J", "\x1b]8;;http://evil\x07link", "k\x00", "\xff\\'")
+
+	f.Fuzz(func(t *testing.T, id, description, key, value string) {
+		line := formatOptions{}.formatLogEventAsPlainText(testEvent(0, LevelInfoName, description, nil, "golog_id", id, key, value))
+		if strings.ContainsAny(line, "\n\r") {
+			t.Fatalf("line %q spans several lines", line)
+		}
+
+		// Values may hold " | ", so only the pairs segment runs to the end.
+		n := 3
+		if id != "" {
+			n = 4
+		}
+		segments := strings.SplitN(line, " | ", n)
+		if id != "" {
+			segments = append(segments[:1], segments[2:]...)
+		}
+		if len(segments) != 3 {
+			t.Fatalf("got %d segments in %q, want 3", len(segments), line)
+		}
+
+		gotDescription, err := textformat.Unescape(segments[1])
+		if err != nil {
+			t.Fatalf("bad description in %q: %v", line, err)
+		}
+		if want := ansiSequence.ReplaceAllString(description, ""); gotDescription != want {
+			t.Errorf("description: got %q, want %q", gotDescription, want)
+		}
+
+		pairs, err := textformat.ParsePairs(segments[2])
+		if err != nil {
+			t.Fatalf("bad pairs in %q: %v", line, err)
+		}
+		if len(pairs) != 1 {
+			t.Fatalf("got %d pairs in %q, want 1", len(pairs), line)
+		}
+		if pairs[0].Key != escapeTextKey(key) {
+			t.Errorf("key: got %q, want %q", pairs[0].Key, escapeTextKey(key))
+		}
+		if want := ansiSequence.ReplaceAllString(value, ""); pairs[0].Value != want {
+			t.Errorf("value: got %q, want %q", pairs[0].Value, want)
+		}
+	})
+}
+
+func FuzzKeyValueSingleLine(f *testing.F) {
+	f.Add("id", "description", "key", "value")
+	f.Add("", "a' level='FATAL", "x' admin='true", "bilbo'\ntimestamp='0' level='ERROR'")
+	f.Add("\x1b[2J", "\x1b]8;;http://evil\x07link", "k\x00", "\xff\\'")
+
+	f.Fuzz(func(t *testing.T, id, description, key, value string) {
+		if key == "golog_id" {
+			t.Skip("the key would replace the id")
+		}
+		line := formatOptions{}.formatLogEventAsKeyValue(testEvent(0, LevelInfoName, description, nil, "golog_id", id, key, value))
+		if strings.ContainsAny(line, "\n\r") {
+			t.Fatalf("line %q spans several lines", line)
+		}
+
+		pairs, err := textformat.ParsePairs(line)
+		if err != nil {
+			t.Fatalf("bad pairs in %q: %v", line, err)
+		}
+		if len(pairs) != 5 {
+			t.Fatalf("got %d pairs in %q, want 5", len(pairs), line)
+		}
+		wantID := ansiSequence.ReplaceAllString(id, "")
+		if id == "" {
+			wantID = "Golog"
+		}
+		for i, want := range []textformat.Pair{
+			{Key: "level", Value: string(LevelInfoName)},
+			{Key: "channel", Value: wantID},
+			{Key: "message", Value: ansiSequence.ReplaceAllString(description, "")},
+			{Key: escapeTextKey(key), Value: ansiSequence.ReplaceAllString(value, "")},
+		} {
+			if pairs[i+1] != want {
+				t.Errorf("got %q, want %q", pairs[i+1], want)
+			}
+		}
+	})
+}
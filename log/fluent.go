@@ -0,0 +1,394 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fluentTagPrefix     = "golog"
+	fluentFlushInterval = time.Second
+	fluentBufferLimit   = 8192
+	fluentAckTimeout    = 5 * time.Second
+	fluentMinBackoff    = 100 * time.Millisecond
+	fluentMaxBackoff    = 30 * time.Second
+)
+
+// FluentConfig - Fluentd forward sink config. Default/unset values for each
+// attribute are safe, except Address.
+type FluentConfig struct {
+	// Network is "tcp" or "unix". Defaults to "tcp".
+	Network string
+	Address string
+
+	// TagPrefix is joined with the golog_id to make each event's tag, e.g.
+	// golog.db. Defaults to "golog".
+	TagPrefix string
+
+	// BatchSize is the number of events buffered before they're sent, in
+	// PackedForward mode. Defaults to 1: each event is sent as it's logged.
+	BatchSize int
+	// FlushInterval is how often a partial batch is sent. Defaults to 1s.
+	FlushInterval time.Duration
+	// BufferLimit is the most events kept while the agent is unreachable, the
+	// oldest being dropped first. Defaults to 8192.
+	BufferLimit int
+
+	// RequireAck asks the agent to acknowledge each message by chunk id, and
+	// resends unacknowledged messages.
+	RequireAck bool
+	// AckTimeout defaults to 5s.
+	AckTimeout time.Duration
+}
+
+// NewFluentSink returns a sink sending each event to a Fluentd or Fluent Bit
+// agent using the Forward protocol, tagged with TagPrefix and the golog_id.
+// The record holds the message, level and every key/value.
+func NewFluentSink(conf FluentConfig) (Sink, error) {
+	if conf.TagPrefix == "" {
+		conf.TagPrefix = fluentTagPrefix
+	}
+
+	w, err := DialFluent(conf)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	return Sink{
+		Output:    w,
+		Level:     defaultLevel,
+		Formatter: FormatterFunc(conf.format),
+	}, nil
+}
+
+// format encodes the event as a Message mode entry, [tag, time, record].
+func (conf FluentConfig) format(e Event) string {
+	fields := e.Fields()
+
+	tag := conf.TagPrefix
+	for _, f := range fields {
+		if f.Key == "golog_id" && f.Value != "" {
+			tag += "." + strings.ReplaceAll(f.Value, " ", "_")
+			break
+		}
+	}
+
+	entry := appendMsgpackArrayHeader(nil, 3)
+	entry = appendMsgpackString(entry, tag)
+	entry = appendMsgpackEventTime(entry, e.Time)
+	entry = appendMsgpackMapHeader(entry, len(fields)+2)
+	entry = appendMsgpackString(entry, "message")
+	entry = appendMsgpackString(entry, e.Message)
+	entry = appendMsgpackString(entry, "level")
+	entry = appendMsgpackString(entry, string(e.Level))
+	for _, f := range fields {
+		entry = appendMsgpackString(entry, f.Key)
+		entry = appendMsgpackString(entry, f.Value)
+	}
+	return string(entry)
+}
+
+// fluentEntry is a buffered event: its tag, and its [time, record] encoding.
+type fluentEntry struct {
+	tag  string
+	body []byte
+}
+
+// FluentWriter is an io.WriteCloser forwarding entries to a Fluentd agent.
+// Entries are buffered and sent in batches per tag, and kept for a later
+// attempt when the agent can't be reached, reconnecting with exponential
+// backoff.
+type FluentWriter struct {
+	conf FluentConfig
+
+	mu       sync.Mutex
+	conn     net.Conn
+	pending  []fluentEntry
+	backoff  time.Duration
+	nextDial time.Time
+	closed   bool
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// DialFluent connects to a Fluentd agent.
+func DialFluent(conf FluentConfig) (*FluentWriter, error) {
+	if conf.Network == "" {
+		conf.Network = "tcp"
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = fluentFlushInterval
+	}
+	if conf.BufferLimit <= 0 {
+		conf.BufferLimit = fluentBufferLimit
+	}
+	if conf.AckTimeout <= 0 {
+		conf.AckTimeout = fluentAckTimeout
+	}
+
+	w := &FluentWriter{conf: conf}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+
+	if conf.BatchSize > 1 {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.flushPeriodically()
+	}
+	return w, nil
+}
+
+func (w *FluentWriter) connect() error {
+	conn, err := net.DialTimeout(w.conf.Network, w.conf.Address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write buffers p, a Message mode entry as produced by the Fluentd sink's
+// formatter followed by the logger's newline, and sends the buffer once
+// BatchSize is reached.
+func (w *FluentWriter) Write(p []byte) (int, error) {
+	entry, err := splitFluentEntry(bytesTrimNewline(p))
+	if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	w.pending = append(w.pending, entry)
+	if over := len(w.pending) - w.conf.BufferLimit; over > 0 {
+		w.pending = w.pending[over:]
+	}
+	if len(w.pending) < w.conf.BatchSize {
+		return len(p), nil
+	}
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// bytesTrimNewline removes the newline the logger terminates entries with.
+func bytesTrimNewline(p []byte) []byte {
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		return p[:len(p)-1]
+	}
+	return p
+}
+
+// splitFluentEntry splits a [tag, time, record] entry into its tag and a
+// [time, record] body.
+func splitFluentEntry(msg []byte) (fluentEntry, error) {
+	if len(msg) == 0 || msg[0] != 0x93 {
+		return fluentEntry{}, errors.New("golog: not a fluent forward entry")
+	}
+	tag, rest, err := decodeMsgpack(msg[1:])
+	if err != nil {
+		return fluentEntry{}, err
+	}
+	tagString, ok := tag.(string)
+	if !ok {
+		return fluentEntry{}, errors.New("golog: fluent forward tag is not a string")
+	}
+
+	return fluentEntry{tag: tagString, body: append([]byte{0x92}, rest...)}, nil
+}
+
+// Flush sends all buffered entries.
+func (w *FluentWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush()
+}
+
+func (w *FluentWriter) flushPeriodically() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.conf.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// flush sends the pending entries, grouped by tag in order of first
+// appearance. Entries that couldn't be sent stay pending.
+func (w *FluentWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	if w.conn == nil {
+		if time.Now().Before(w.nextDial) {
+			return fmt.Errorf("golog: fluent agent unreachable, next attempt in %v", time.Until(w.nextDial).Round(time.Millisecond))
+		}
+		if err := w.connect(); err != nil {
+			w.fail()
+			return err
+		}
+	}
+
+	var tags []string
+	byTag := make(map[string][]fluentEntry)
+	for _, entry := range w.pending {
+		if _, ok := byTag[entry.tag]; !ok {
+			tags = append(tags, entry.tag)
+		}
+		byTag[entry.tag] = append(byTag[entry.tag], entry)
+	}
+
+	for i, tag := range tags {
+		if err := w.send(tag, byTag[tag]); err != nil {
+			w.fail()
+			var unsent []fluentEntry
+			for _, tag := range tags[i:] {
+				unsent = append(unsent, byTag[tag]...)
+			}
+			w.pending = unsent
+			return err
+		}
+	}
+
+	w.pending = w.pending[:0]
+	w.backoff = 0
+	return nil
+}
+
+// fail drops the connection and schedules the next attempt.
+func (w *FluentWriter) fail() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if w.backoff == 0 {
+		w.backoff = fluentMinBackoff
+	} else if w.backoff *= 2; w.backoff > fluentMaxBackoff {
+		w.backoff = fluentMaxBackoff
+	}
+	w.nextDial = time.Now().Add(w.backoff)
+}
+
+// send sends entries sharing a tag: in Message mode if there's a single one,
+// and in PackedForward mode otherwise.
+func (w *FluentWriter) send(tag string, entries []fluentEntry) error {
+	var chunk string
+	if w.conf.RequireAck {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+
+	var msg []byte
+	if len(entries) == 1 {
+		msg = appendMsgpackArrayHeader(nil, 4)
+		msg = appendMsgpackString(msg, tag)
+		// Inline the [time, record] body, minus its array header.
+		msg = append(msg, entries[0].body[1:]...)
+	} else {
+		var packed []byte
+		for _, entry := range entries {
+			packed = append(packed, entry.body...)
+		}
+		msg = appendMsgpackArrayHeader(nil, 3)
+		msg = appendMsgpackString(msg, tag)
+		msg = appendMsgpackBin(msg, packed)
+	}
+
+	options := 1
+	if chunk != "" {
+		options++
+	}
+	msg = appendMsgpackMapHeader(msg, options)
+	msg = appendMsgpackString(msg, "size")
+	msg = appendMsgpackUint(msg, uint64(len(entries)))
+	if chunk != "" {
+		msg = appendMsgpackString(msg, "chunk")
+		msg = appendMsgpackString(msg, chunk)
+	}
+
+	if _, err := w.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	return w.readAck(chunk)
+}
+
+func (w *FluentWriter) readAck(chunk string) error {
+	w.conn.SetReadDeadline(time.Now().Add(w.conf.AckTimeout))
+	defer w.conn.SetReadDeadline(time.Time{})
+
+	var buf []byte
+	read := make([]byte, 512)
+	for {
+		n, err := w.conn.Read(read)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, read[:n]...)
+
+		response, _, err := decodeMsgpack(buf)
+		if errors.Is(err, errMsgpackShort) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ack, _ := response.(map[string]any); ack["ack"] != chunk {
+			return fmt.Errorf("golog: fluent agent acknowledged %v, want chunk %q", ack["ack"], chunk)
+		}
+		return nil
+	}
+}
+
+// Close sends buffered entries and closes the connection.
+func (w *FluentWriter) Close() error {
+	if w.stop != nil {
+		w.stopOnce.Do(func() { close(w.stop) })
+		<-w.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+
+	err := w.flush()
+	if w.conn != nil {
+		if closeErr := w.conn.Close(); err == nil {
+			err = closeErr
+		}
+		w.conn = nil
+	}
+	return err
+}
@@ -0,0 +1,373 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fluentEvent struct {
+	tag    string
+	time   time.Time
+	record map[string]any
+}
+
+// fluentServer is an in-process stand-in for a Fluentd agent, accepting the
+// Message, Forward and PackedForward modes and acknowledging chunks.
+type fluentServer struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu       sync.Mutex
+	events   []fluentEvent
+	messages int
+	conns    []net.Conn
+	// ignoreAcks makes the server read messages without acknowledging them.
+	ignoreAcks bool
+}
+
+func newFluentServer(t *testing.T) *fluentServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &fluentServer{t: t, listener: listener}
+	t.Cleanup(s.close)
+	go s.accept()
+	return s
+}
+
+func (s *fluentServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fluentServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// dropConnections closes every open connection, as a restarting agent would.
+func (s *fluentServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fluentServer) close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func (s *fluentServer) serve(conn net.Conn) {
+	var buf []byte
+	read := make([]byte, 4096)
+	for {
+		n, err := conn.Read(read)
+		if err != nil {
+			return
+		}
+		buf = append(buf, read[:n]...)
+
+		for len(buf) > 0 {
+			msg, rest, err := decodeMsgpack(buf)
+			if errors.Is(err, errMsgpackShort) {
+				break
+			}
+			if err != nil {
+				s.t.Errorf("undecodable message: %v", err)
+				return
+			}
+			buf = rest
+			if chunk := s.handle(msg.([]any)); chunk != "" && !s.ignoreAcks {
+				ack := appendMsgpackMapHeader(nil, 1)
+				ack = appendMsgpackString(ack, "ack")
+				conn.Write(appendMsgpackString(ack, chunk))
+			}
+		}
+	}
+}
+
+func (s *fluentServer) handle(msg []any) (chunk string) {
+	tag := msg[0].(string)
+	var events []fluentEvent
+	var options map[string]any
+
+	switch entries := msg[1].(type) {
+	case msgpackExt, int64, uint64:
+		// Message mode: [tag, time, record, option?]
+		events = append(events, s.event(tag, entries, msg[2]))
+		if len(msg) > 3 {
+			options, _ = msg[3].(map[string]any)
+		}
+	case []any:
+		// Forward mode: [tag, [[time, record], ...], option?]
+		for _, entry := range entries {
+			pair := entry.([]any)
+			events = append(events, s.event(tag, pair[0], pair[1]))
+		}
+		if len(msg) > 2 {
+			options, _ = msg[2].(map[string]any)
+		}
+	case []byte, string:
+		// PackedForward mode: [tag, packed entries, option?]
+		packed := []byte(fmtString(entries))
+		for len(packed) > 0 {
+			entry, rest, err := decodeMsgpack(packed)
+			if err != nil {
+				s.t.Errorf("undecodable packed entry: %v", err)
+				return ""
+			}
+			packed = rest
+			pair := entry.([]any)
+			events = append(events, s.event(tag, pair[0], pair[1]))
+		}
+		if len(msg) > 2 {
+			options, _ = msg[2].(map[string]any)
+		}
+	}
+
+	if size, ok := options["size"]; ok && size != uint64(len(events)) && size != int64(len(events)) {
+		s.t.Errorf("got size option %v for %d events", size, len(events))
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, events...)
+	s.messages++
+	s.mu.Unlock()
+
+	chunk, _ = options["chunk"].(string)
+	return chunk
+}
+
+func fmtString(v any) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v.(string)
+}
+
+func (s *fluentServer) event(tag string, eventTime any, record any) fluentEvent {
+	var t time.Time
+	switch v := eventTime.(type) {
+	case msgpackExt:
+		t = time.Unix(int64(binary.BigEndian.Uint32(v.Data[:4])), int64(binary.BigEndian.Uint32(v.Data[4:])))
+	case int64:
+		t = time.Unix(v, 0)
+	case uint64:
+		t = time.Unix(int64(v), 0)
+	}
+	return fluentEvent{tag: tag, time: t, record: record.(map[string]any)}
+}
+
+func (s *fluentServer) waitForEvents(t *testing.T, n int) ([]fluentEvent, int) {
+	t.Helper()
+	var events []fluentEvent
+	var messages int
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		events = append([]fluentEvent(nil), s.events...)
+		messages = s.messages
+		return len(events) >= n
+	})
+	return events, messages
+}
+
+func TestFluentSink(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("sends each event in message mode", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr(), TagPrefix: "app"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		before := time.Now()
+		New(Config{ID: "db", Sinks: []Sink{sink}}, "region", "us").Error("oh no", "key", "value")
+		New(Config{Sinks: []Sink{sink}}).Info("no id")
+
+		events, messages := server.waitForEvents(t, 2)
+		if messages != 2 {
+			t.Errorf("got %d messages, want 2", messages)
+		}
+		if events[0].tag != "app.db" || events[1].tag != "app" {
+			t.Errorf("got tags %q and %q", events[0].tag, events[1].tag)
+		}
+		want := map[string]any{"message": "oh no", "level": "ERROR", "golog_id": "db", "region": "us", "key": "value"}
+		for key, value := range want {
+			if events[0].record[key] != value {
+				t.Errorf("%s: got %v, want %v", key, events[0].record[key], value)
+			}
+		}
+		if events[0].time.Before(before.Truncate(time.Second)) || events[0].time.After(time.Now()) {
+			t.Errorf("got time %v", events[0].time)
+		}
+	})
+
+	t.Run("batches events in packed forward mode", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr(), BatchSize: 3, FlushInterval: time.Hour})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		db := New(Config{ID: "db", Sinks: []Sink{sink}})
+		web := New(Config{ID: "web", Sinks: []Sink{sink}})
+
+		db.Info("one")
+		web.Info("two")
+		time.Sleep(20 * time.Millisecond)
+		if events, _ := server.waitForEvents(t, 0); len(events) != 0 {
+			t.Fatalf("got %d events before the batch was full", len(events))
+		}
+		db.Info("three")
+
+		events, messages := server.waitForEvents(t, 3)
+		if messages != 2 {
+			t.Errorf("got %d messages, want one per tag", messages)
+		}
+		var got []string
+		for _, event := range events {
+			got = append(got, event.tag+":"+event.record["message"].(string))
+		}
+		if want := "golog.db:one golog.db:three golog.web:two"; strings.Join(got, " ") != want {
+			t.Errorf("got %q, want %q", strings.Join(got, " "), want)
+		}
+	})
+
+	t.Run("flushes partial batches periodically and on Close", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr(), BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger := New(Config{Sinks: []Sink{sink}})
+
+		logger.Info("periodic")
+		server.waitForEvents(t, 1)
+
+		w := sink.Output.(*FluentWriter)
+		w.stopOnce.Do(func() { close(w.stop) })
+		<-w.done
+		logger.Info("closing")
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		server.waitForEvents(t, 2)
+	})
+
+	t.Run("waits for acks", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr(), RequireAck: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := sink.Output.Write([]byte(sink.Formatter.Format(testEvent(0, LevelInfoName, "acked", nil)) + "\n")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		server.waitForEvents(t, 1)
+	})
+
+	t.Run("keeps unacknowledged events", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		server.ignoreAcks = true
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr(), RequireAck: true, AckTimeout: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		w := sink.Output.(*FluentWriter)
+		if _, err := w.Write([]byte(sink.Formatter.Format(testEvent(0, LevelInfoName, "lost ack", nil)) + "\n")); err == nil {
+			t.Fatal("expected an error")
+		}
+		w.mu.Lock()
+		pending := len(w.pending)
+		w.mu.Unlock()
+		if pending != 1 {
+			t.Errorf("got %d pending events, want 1", pending)
+		}
+	})
+
+	t.Run("reconnects with backoff", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		w := sink.Output.(*FluentWriter)
+		logger := New(Config{Sinks: []Sink{sink}})
+
+		logger.Info("before")
+		server.waitForEvents(t, 1)
+		server.dropConnections()
+
+		// Writes may still succeed until the client notices the connection is
+		// gone, after which it backs off before reconnecting, keeping events.
+		waitFor(t, func() bool {
+			logger.Info("during")
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return w.conn == nil
+		})
+		w.mu.Lock()
+		if w.backoff != fluentMinBackoff || len(w.pending) == 0 {
+			t.Errorf("got backoff %v with %d pending events", w.backoff, len(w.pending))
+		}
+		w.nextDial = time.Time{}
+		w.mu.Unlock()
+
+		logger.Info("after")
+		events, _ := server.waitForEvents(t, 2)
+		if last := events[len(events)-1].record["message"]; last != "after" {
+			t.Errorf("got last event %v, want %q", last, "after")
+		}
+		w.mu.Lock()
+		if w.backoff != 0 || len(w.pending) != 0 {
+			t.Errorf("got backoff %v with %d pending events after reconnecting", w.backoff, len(w.pending))
+		}
+		w.mu.Unlock()
+	})
+
+	t.Run("drops the oldest events past the buffer limit", func(t *testing.T) {
+		resetLogging(t)
+		server := newFluentServer(t)
+		sink, err := NewFluentSink(FluentConfig{Address: server.addr(), BatchSize: 10, BufferLimit: 2, FlushInterval: time.Hour})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger := New(Config{Sinks: []Sink{sink}})
+		for _, msg := range []string{"one", "two", "three"} {
+			logger.Info(msg)
+		}
+		if err := sink.Output.(*FluentWriter).Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		events, _ := server.waitForEvents(t, 2)
+		if len(events) != 2 || events[0].record["message"] != "two" {
+			t.Errorf("got %v", events)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event is a single log event, as handed to a Formatter.
+type Event struct {
+	Time    time.Time
+	Level   LogLevelName
+	Message string
+	// StaticFields are the logger's static fields, the golog_id set by
+	// Config.ID included, in the order they were set.
+	StaticFields []Field
+	// KeysAndValues are the call's key/values, in pairs: the golog_id passed to
+	// package functions such as Info, the caller's file and line, and the
+	// caller's own.
+	KeysAndValues []any
+	// Flags are the sink's stdlib log flags.
+	Flags int
+
+	// order is the logger's Config.SortFields and Config.PriorityFields.
+	order *fieldOrder
+}
+
+// Field is a single key/value of an event.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Fields merges the event's static fields and call-site key/values into a
+// single list: static fields first, then call-site fields, each in the order
+// they were set, unless the logger sorts them or puts some first. Call-site
+// fields override static fields with the same key.
+func (e Event) Fields() []Field {
+	return e.order.apply(eventFields(e.StaticFields, e.KeysAndValues))
+}
+
+// fieldOrder reorders fields: those named in priority first, in that order,
+// then the rest, sorted by key if sorted is set.
+type fieldOrder struct {
+	sorted   bool
+	priority map[string]int
+}
+
+func newFieldOrder(conf Config) *fieldOrder {
+	if !conf.SortFields && len(conf.PriorityFields) == 0 {
+		return nil
+	}
+
+	order := &fieldOrder{sorted: conf.SortFields, priority: make(map[string]int, len(conf.PriorityFields))}
+	for _, key := range conf.PriorityFields {
+		if _, ok := order.priority[key]; !ok {
+			order.priority[key] = len(order.priority)
+		}
+	}
+	return order
+}
+
+// apply sorts fields in place. A nil order keeps them as they are.
+func (o *fieldOrder) apply(fields []Field) []Field {
+	if o == nil {
+		return fields
+	}
+
+	rank := func(key string) int {
+		if i, ok := o.priority[key]; ok {
+			return i
+		}
+		return len(o.priority)
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		if ri, rj := rank(fields[i].Key), rank(fields[j].Key); ri != rj {
+			return ri < rj
+		}
+		return o.sorted && fields[i].Key < fields[j].Key
+	})
+	return fields
+}
+
+// Formatter renders an event as a single log entry, without a trailing
+// newline.
+type Formatter interface {
+	Format(e Event) string
+}
+
+// FormatterFunc adapts a function to the Formatter interface.
+type FormatterFunc func(e Event) string
+
+// Format calls f(e).
+func (f FormatterFunc) Format(e Event) string {
+	return f(e)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = make(map[LogFormat]Formatter)
+)
+
+// RegisterFormat makes a formatter available by name, to Config.Format,
+// Sink.Format and LOG_ENCODING. It panics if name is empty or already taken,
+// or formatter is nil.
+func RegisterFormat(name LogFormat, formatter Formatter) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	if formatter == nil {
+		panic("golog: RegisterFormat formatter is nil")
+	}
+	if _, ok := formats[name]; ok || name == DefaultFormat || isBuiltinFormat(name) {
+		panic(fmt.Sprintf("golog: RegisterFormat called twice for format %q", name))
+	}
+	formats[name] = formatter
+}
+
+func registeredFormat(name LogFormat) Formatter {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	return formats[name]
+}
+
+// NewFormatter returns the formatter for conf.Format, with conf's time and
+// field settings, to render events outside a logger, such as those read back
+// with the parse package. ConsoleFormat has colors when w, where the output
+// goes, is a terminal, as for a sink.
+//
+// With no stdlib logger to write them, the text formats write the timestamp
+// themselves, following each event's Flags without a TimeFormat, and start
+// with the event's prefix field, if any. The other formats ignore Flags.
+func NewFormatter(w io.Writer, conf Config) Formatter {
+	opts := newFormatOptions(conf)
+	if !opts.ownsTimestamp() {
+		opts.timeLocation = time.Local
+	}
+
+	var formatter Formatter
+	text := false
+	switch format := SanitizeFormat(conf.Format); {
+	case conf.Formatter != nil:
+		return conf.Formatter
+	case registeredFormat(format) != nil:
+		return registeredFormat(format)
+	case format == JsonFormat:
+		formatter = FormatterFunc(opts.formatLogEventAsJson)
+	case format == KeyValueFormat:
+		formatter = FormatterFunc(opts.formatLogEventAsKeyValue)
+	case format == LogfmtFormat:
+		formatter = FormatterFunc(opts.formatLogEventAsLogfmt)
+	case format == EcsFormat:
+		formatter = FormatterFunc(formatLogEventAsEcs)
+	case format == CloudLoggingFormat:
+		formatter = cloudLoggingFormatter(os.Getenv("GOOGLE_CLOUD_PROJECT"))
+	case format == PrettyFormat:
+		formatter, text = FormatterFunc(opts.formatLogEventAsPretty), true
+	case format == TemplateFormat:
+		formatter, text = opts.templateFormatter(), true
+	case format == ConsoleFormat && colorEnabled(w):
+		formatter, text = FormatterFunc(opts.formatLogEventAsConsole), true
+	default:
+		formatter, text = FormatterFunc(opts.formatLogEventAsPlainText), true
+	}
+
+	return FormatterFunc(func(e Event) string {
+		if !text {
+			e.Flags = FlagsNone
+			return formatter.Format(e)
+		}
+		prefix, fields := popField(e.Fields(), "prefix")
+		e.StaticFields, e.KeysAndValues, e.order = fields, nil, nil
+		return prefix + formatter.Format(e)
+	})
+}
@@ -0,0 +1,249 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEvent builds an event logged now, the way a logger would.
+func testEvent(flags int, level LogLevelName, description string, staticFields []Field, args ...any) Event {
+	return Event{
+		Time:          time.Now(),
+		Level:         level,
+		Message:       description,
+		StaticFields:  staticFields,
+		KeysAndValues: args,
+		Flags:         flags,
+	}
+}
+
+// upperFormatter is a custom format, for registry tests.
+var upperFormatter = FormatterFunc(func(e Event) string {
+	line := string(e.Level) + " " + strings.ToUpper(e.Message)
+	for _, f := range e.Fields() {
+		line += " " + f.Key + ":" + f.Value
+	}
+	return line
+})
+
+func TestFormatters(t *testing.T) {
+	resetLogging(t)
+	// Registrations last for the process, which -count reruns tests in.
+	if registeredFormat("upper") == nil {
+		RegisterFormat("upper", upperFormatter)
+	}
+
+	t.Run("uses a formatter from the config", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		New(Config{ID: "id", Formatter: upperFormatter}, "static", "field").Info("hello", "k", "v")
+
+		if got, want := output.String(), "INFO HELLO golog_id:id static:field k:v\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("leaves the prefix and flags to the formatter", func(t *testing.T) {
+		resetLogging(t)
+		t.Setenv("LOG_PREFIX", "app")
+		initLogging()
+		output := new(bytes.Buffer)
+		var flags int
+		sink := NewSink(output, DefaultFormat)
+		sink.Flags = FlagsDate
+		sink.Formatter = FormatterFunc(func(e Event) string {
+			flags = e.Flags
+			return e.Message
+		})
+		New(Config{Sinks: []Sink{sink}}).Info("hello")
+
+		if got := output.String(); got != "hello\n" {
+			t.Errorf("got %q, want %q", got, "hello\n")
+		}
+		if flags != FlagsDate {
+			t.Errorf("got flags %d, want %d", flags, FlagsDate)
+		}
+	})
+
+	t.Run("passes the event", func(t *testing.T) {
+		resetLogging(t)
+		var got Event
+		sink := NewSink(new(bytes.Buffer), DefaultFormat)
+		sink.Formatter = FormatterFunc(func(e Event) string {
+			got = e
+			return ""
+		})
+		before := time.Now()
+		New(Config{ID: "id", Sinks: []Sink{sink}}).Warn("careful", "k", 1)
+
+		if got.Level != LevelWarnName || got.Message != "careful" || len(got.StaticFields) != 1 || got.StaticFields[0] != (Field{"golog_id", "id"}) {
+			t.Errorf("unexpected event %+v", got)
+		}
+		if len(got.KeysAndValues) != 2 || got.KeysAndValues[0] != "k" || got.KeysAndValues[1] != 1 {
+			t.Errorf("got key/values %v, want the raw values", got.KeysAndValues)
+		}
+		if got.Time.Before(before) {
+			t.Errorf("got time %v, before the call at %v", got.Time, before)
+		}
+	})
+
+	t.Run("merges fields", func(t *testing.T) {
+		e := testEvent(0, LevelInfoName, "msg", []Field{{"b", "static"}, {"a", "static"}, {"k", "static"}}, "k", "call", "c", 3)
+		want := []Field{{"b", "static"}, {"a", "static"}, {"k", "call"}, {"c", "3"}}
+		got := e.Fields()
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+	})
+
+	t.Run("registers formats by name", func(t *testing.T) {
+		resetLogging(t)
+		t.Setenv("LOG_ENCODING", "upper")
+		if got := SanitizeFormat(DefaultFormat); got != "upper" {
+			t.Errorf("got %q, want upper", got)
+		}
+
+		output := new(bytes.Buffer)
+		New(Config{Sinks: []Sink{NewSink(output, "upper")}}).Error("oops")
+		if got := output.String(); got != "ERROR OOPS\n" {
+			t.Errorf("got %q, want %q", got, "ERROR OOPS\n")
+		}
+	})
+
+	t.Run("refuses to register twice or over built-in formats", func(t *testing.T) {
+		for _, name := range []LogFormat{"upper", JsonFormat, DefaultFormat} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("expected a panic registering %q", name)
+					}
+				}()
+				RegisterFormat(name, upperFormatter)
+			}()
+		}
+	})
+}
+
+func TestFieldOrder(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("keeps the order fields were set in", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		logger := New(Config{ID: "id"}, "z", 1, "y", 2, "x", 3, "w", 4, "v", 5)
+		logger.SetStaticField("a", 6)
+		logger.SetStaticField("y", 7)
+		for i := 0; i < 10; i++ {
+			logger.Info("msg", "c", 8, "b", 9)
+		}
+
+		want := strings.Repeat("INFO | id | msg | z='1' y='7' x='3' w='4' v='5' a='6' c='8' b='9'\n", 10)
+		if got := output.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("sorts fields", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		New(Config{Format: LogfmtFormat, ID: "id", SortFields: true, TimeFormat: TimeFormatEpochSeconds}, "z", 1, "b", 2).
+			Info("msg", "y", 3, "a", 4)
+
+		if got, want := output.String()[strings.Index(output.String(), " level="):], " level=info id=id msg=msg a=4 b=2 y=3 z=1\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("puts priority fields first", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		New(Config{PriorityFields: []string{"request_id", "user", "request_id"}, SortFields: true}, "z", 1, "user", "bob").
+			Info("msg", "y", 2, "request_id", "r1")
+
+		if got, want := output.String(), "INFO | msg | request_id='r1' user='bob' y='2' z='1'\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+
+		e := testEvent(0, LevelInfoName, "msg", []Field{{"b", "1"}, {"a", "2"}}, "user", "bob")
+		e.order = newFieldOrder(Config{PriorityFields: []string{"user"}})
+		if got, want := expandKeyValuePairs(e.Fields()), "user='bob' b='1' a='2'"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("orders json objects", func(t *testing.T) {
+		e := testEvent(0, LevelInfoName, "msg", []Field{{"golog_id", "id"}, {"b", "1"}}, "user", "bob", "a", "2", "error", "oops")
+		e.order = newFieldOrder(Config{PriorityFields: []string{"user", "error"}})
+
+		line := formatOptions{}.formatLogEventAsJson(e)
+		if got, want := line[strings.Index(line, `"fields"`):], `"fields":{"user":"bob","error":"oops","golog_id":"id","b":"1","a":"2"}}`; got != want {
+			t.Errorf("json: got %q, want %q", got, want)
+		}
+		ecs := formatLogEventAsEcs(e)
+		if got, want := ecs[strings.Index(ecs, `"log"`):], `"log":{"logger":"id"},"error":{"message":"oops"},"labels":{"user":"bob","b":"1","a":"2"}}`; got != want {
+			t.Errorf("ecs: got %q, want %q", got, want)
+		}
+		cloud := cloudLoggingFormatter("").Format(e)
+		if got, want := cloud[strings.Index(cloud, `"user"`):], `"user":"bob","error":"oops","a":"2","logging.googleapis.com/labels":{"golog_id":"id","b":"1"}}`; got != want {
+			t.Errorf("cloud logging: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("leaves logged events untouched", func(t *testing.T) {
+		resetLogging(t)
+		var logged []Event
+		sink := NewSink(new(bytes.Buffer), DefaultFormat)
+		sink.Formatter = FormatterFunc(func(e Event) string {
+			logged = append(logged, e)
+			return ""
+		})
+		logger := New(Config{Sinks: []Sink{sink}}, "k", "before")
+		logger.Info("msg")
+		logger.SetStaticField("k", "after")
+		logger.Info("msg")
+
+		if got := logged[0].StaticFields[0].Value; got != "before" {
+			t.Errorf("got %q for the first event, want before", got)
+		}
+		if got := logged[1].StaticFields[0].Value; got != "after" {
+			t.Errorf("got %q for the second event, want after", got)
+		}
+	})
+}
+
+func TestNewFormatter(t *testing.T) {
+	resetLogging(t)
+	e := Event{
+		Time:          time.Date(2009, 1, 23, 1, 23, 23, 0, time.UTC),
+		Level:         LevelInfoName,
+		Message:       "Hello.",
+		KeysAndValues: []any{"golog_id", "api", "prefix", "myapp: ", "k", "v"},
+		Flags:         FlagsDefault,
+	}
+
+	for _, test := range []struct {
+		conf Config
+		want string
+	}{
+		{Config{Format: PlainTextFormat, TimeLocation: time.UTC}, "myapp: 2009/01/23 01:23:23 | INFO | api | Hello. | k='v'"},
+		{Config{Format: ConsoleFormat, TimeFormat: time.Kitchen, TimeLocation: time.UTC}, "myapp: 1:23AM | INFO | api | Hello. | k='v'"},
+		{Config{Format: KeyValueFormat}, "timestamp='1232673803' level='INFO' channel='api' message='Hello.' prefix='myapp: ' k='v'"},
+		{Config{Format: JsonFormat, TimeFormat: time.RFC3339}, `{"ts":"2009-01-23T01:23:23Z","lvl":"INFO","msg":"Hello.","fields":{"golog_id":"api","prefix":"myapp: ","k":"v"}}`},
+	} {
+		// Not a terminal, so console is plain text.
+		if got := NewFormatter(new(bytes.Buffer), test.conf).Format(e); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.conf.Format, got, test.want)
+		}
+	}
+}
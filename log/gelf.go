@@ -0,0 +1,268 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GelfCompression selects how GELF messages are compressed over UDP.
+type GelfCompression int
+
+const (
+	GelfCompressNone GelfCompression = iota
+	GelfCompressGzip
+	GelfCompressZlib
+)
+
+const (
+	// gelfChunkSize fits a chunk into a typical ethernet MTU.
+	gelfChunkSize = 1420
+	// gelfMaxChunks is the most chunks a GELF message may be split into.
+	gelfMaxChunks = 128
+	// gelfChunkHeaderSize is the magic bytes, message id, sequence number and
+	// sequence count.
+	gelfChunkHeaderSize = 2 + 8 + 1 + 1
+)
+
+// GelfConfig - GELF sink config. Default/unset values for each attribute are
+// safe, except Network and Address.
+type GelfConfig struct {
+	// Network is "udp" or "tcp".
+	Network string
+	Address string
+
+	// Host defaults to os.Hostname().
+	Host string
+	// Compression applies to UDP only, as GELF over TCP doesn't support it.
+	Compression GelfCompression
+	// ChunkSize is the largest UDP datagram sent, header included. Defaults to
+	// 1420 bytes.
+	ChunkSize int
+}
+
+// NewGelfSink returns a sink sending each event as a GELF 1.1 message, with the
+// description as short_message, the level as syslog severity, and every
+// key/value, golog_id included, as an additional field.
+func NewGelfSink(conf GelfConfig) (Sink, error) {
+	if conf.Host == "" {
+		conf.Host, _ = os.Hostname()
+	}
+
+	w, err := DialGelf(conf)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	return Sink{
+		Output:    w,
+		Level:     defaultLevel,
+		Formatter: FormatterFunc(conf.format),
+	}, nil
+}
+
+func (conf GelfConfig) format(e Event) string {
+	msg := map[string]any{
+		"version":       "1.1",
+		"host":          conf.Host,
+		"short_message": e.Message,
+		"timestamp":     float64(e.Time.UnixNano()/int64(time.Millisecond)) / 1000,
+		"level":         syslogSeverities[e.Level],
+	}
+	for _, f := range e.Fields() {
+		msg[gelfFieldName(f.Key)] = f.Value
+	}
+
+	// Only strings and numbers, which can't fail to marshal.
+	encoded, _ := json.Marshal(msg)
+	return string(encoded)
+}
+
+// gelfFieldName makes key an additional field name: underscore prefixed, only
+// word characters, dots and dashes, and never the reserved _id.
+func gelfFieldName(key string) string {
+	name := []byte("_" + key)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			name[i] = '_'
+		}
+	}
+	if string(name) == "_id" {
+		return "_id_"
+	}
+	return string(name)
+}
+
+// GelfWriter is an io.WriteCloser sending each Write as one GELF message:
+// optionally compressed and chunked over UDP, or null delimited over TCP. A
+// failed write is retried once on a fresh connection.
+type GelfWriter struct {
+	conf GelfConfig
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+// DialGelf connects to a GELF input.
+func DialGelf(conf GelfConfig) (*GelfWriter, error) {
+	switch conf.Network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("golog: unsupported GELF network %q", conf.Network)
+	}
+	if conf.ChunkSize == 0 {
+		conf.ChunkSize = gelfChunkSize
+	}
+	if conf.ChunkSize <= gelfChunkHeaderSize {
+		return nil, fmt.Errorf("golog: GELF chunk size %d is too small", conf.ChunkSize)
+	}
+
+	w := &GelfWriter{conf: conf}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *GelfWriter) connect() error {
+	conn, err := net.DialTimeout(w.conf.Network, w.conf.Address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *GelfWriter) isUDP() bool {
+	return strings.HasPrefix(w.conf.Network, "udp")
+}
+
+// Write sends p, without its trailing newline, as a single message.
+func (w *GelfWriter) Write(p []byte) (int, error) {
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+
+	var packets [][]byte
+	if w.isUDP() {
+		compressed, err := w.compress(msg)
+		if err != nil {
+			return 0, err
+		}
+		if packets, err = w.chunk(compressed); err != nil {
+			return 0, err
+		}
+	} else {
+		packets = [][]byte{append(msg[:len(msg):len(msg)], 0)}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if err = w.send(packets); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+func (w *GelfWriter) send(packets [][]byte) error {
+	for _, packet := range packets {
+		if _, err := w.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *GelfWriter) compress(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch w.conf.Compression {
+	case GelfCompressGzip:
+		zw = gzip.NewWriter(&buf)
+	case GelfCompressZlib:
+		zw = zlib.NewWriter(&buf)
+	default:
+		return msg, nil
+	}
+
+	if _, err := zw.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunk splits msg into GELF chunks if it doesn't fit a single datagram.
+func (w *GelfWriter) chunk(msg []byte) ([][]byte, error) {
+	if len(msg) <= w.conf.ChunkSize {
+		return [][]byte{msg}, nil
+	}
+
+	dataSize := w.conf.ChunkSize - gelfChunkHeaderSize
+	count := (len(msg) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("golog: GELF message of %d bytes needs more than %d chunks", len(msg), gelfMaxChunks)
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := msg[i*dataSize:]
+		if len(data) > dataSize {
+			data = data[:dataSize]
+		}
+
+		chunk := make([]byte, 0, gelfChunkHeaderSize+len(data))
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, data...))
+	}
+	return chunks, nil
+}
+
+// Close closes the connection.
+func (w *GelfWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
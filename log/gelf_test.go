@@ -0,0 +1,198 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readGelf reads one GELF message from a UDP listener, reassembling chunks and
+// decompressing as needed.
+func readGelf(t *testing.T, conn net.PacketConn) map[string]any {
+	t.Helper()
+	chunks := map[byte][]byte{}
+	var count byte
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		if len(packet) < 2 || packet[0] != 0x1e || packet[1] != 0x0f {
+			return decodeGelf(t, packet)
+		}
+		chunks[packet[10]] = packet[12:]
+		count = packet[11]
+		if len(chunks) == int(count) {
+			break
+		}
+	}
+
+	var msg []byte
+	for i := byte(0); i < count; i++ {
+		msg = append(msg, chunks[i]...)
+	}
+	return decodeGelf(t, msg)
+}
+
+func decodeGelf(t *testing.T, msg []byte) map[string]any {
+	t.Helper()
+	var r io.Reader = bytes.NewReader(msg)
+	switch {
+	case bytes.HasPrefix(msg, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		r = gz
+	case bytes.HasPrefix(msg, []byte{0x78}):
+		z, err := zlib.NewReader(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		r = z
+	}
+
+	var decoded map[string]any
+	if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return decoded
+}
+
+func listenGelf(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGelfSink(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("converts events to GELF messages", func(t *testing.T) {
+		resetLogging(t)
+		server := listenGelf(t)
+		sink, err := NewGelfSink(GelfConfig{Network: "udp", Address: server.LocalAddr().String(), Host: "host"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		before := float64(time.Now().Unix())
+		New(Config{ID: "db", Sinks: []Sink{sink}}, "id", "42").Error("oh no", "user name", "bilbo")
+
+		msg := readGelf(t, server)
+		want := map[string]any{
+			"version":       "1.1",
+			"host":          "host",
+			"short_message": "oh no",
+			"level":         float64(3),
+			"_golog_id":     "db",
+			"_id_":          "42",
+			"_user_name":    "bilbo",
+		}
+		for key, value := range want {
+			if msg[key] != value {
+				t.Errorf("%s: got %v, want %v", key, msg[key], value)
+			}
+		}
+		if ts, _ := msg["timestamp"].(float64); ts < before {
+			t.Errorf("got timestamp %v, want at least %v", msg["timestamp"], before)
+		}
+	})
+
+	for name, compression := range map[string]GelfCompression{"gzip": GelfCompressGzip, "zlib": GelfCompressZlib} {
+		t.Run("compresses with "+name, func(t *testing.T) {
+			resetLogging(t)
+			server := listenGelf(t)
+			sink, err := NewGelfSink(GelfConfig{Network: "udp", Address: server.LocalAddr().String(), Compression: compression})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			New(Config{Sinks: []Sink{sink}}).Info("compressed")
+
+			if msg := readGelf(t, server); msg["short_message"] != "compressed" {
+				t.Errorf("got %v", msg)
+			}
+		})
+	}
+
+	t.Run("chunks large messages", func(t *testing.T) {
+		resetLogging(t)
+		server := listenGelf(t)
+		sink, err := NewGelfSink(GelfConfig{Network: "udp", Address: server.LocalAddr().String(), ChunkSize: 512})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		payload := strings.Repeat("0123456789", 500)
+		New(Config{Sinks: []Sink{sink}}).Info("big", "payload", payload)
+
+		if msg := readGelf(t, server); msg["_payload"] != payload {
+			t.Errorf("payload does not round trip")
+		}
+	})
+
+	t.Run("rejects messages needing too many chunks", func(t *testing.T) {
+		server := listenGelf(t)
+		w, err := DialGelf(GelfConfig{Network: "udp", Address: server.LocalAddr().String(), ChunkSize: 20})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := w.Write(bytes.Repeat([]byte("x"), 8*129)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("sends null delimited messages over tcp", func(t *testing.T) {
+		resetLogging(t)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer listener.Close()
+
+		sink, err := NewGelfSink(GelfConfig{Network: "tcp", Address: listener.Addr().String()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger := New(Config{Sinks: []Sink{sink}})
+		logger.Info("first")
+		logger.Info("second")
+
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for _, want := range []string{"first", "second"} {
+			frame, err := r.ReadBytes(0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg := decodeGelf(t, bytes.TrimSuffix(frame, []byte{0})); msg["short_message"] != want {
+				t.Errorf("got %v, want %q", msg, want)
+			}
+		}
+	})
+
+	t.Run("rejects unsupported networks", func(t *testing.T) {
+		if _, err := NewGelfSink(GelfConfig{Network: "unix"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,106 @@
+// Package textformat reads back the escaping of golog's text formats,
+// described in the log package doc, for the parse package and the log
+// package's own tests.
+package textformat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pair is a single k='v' pair of a text line.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// ParsePairs parses space separated k='v' pairs, such as the pairs segment of
+// a PlainTextFormat line or a whole KeyValueFormat line, unescaping values.
+// Keys may be empty, as the formats write them.
+func ParsePairs(s string) ([]Pair, error) {
+	var pairs []Pair
+	for len(s) > 0 {
+		eq := strings.Index(s, "='")
+		if eq < 0 {
+			return nil, fmt.Errorf("expected a key at %q", s)
+		}
+		key := s[:eq]
+		if strings.ContainsAny(key, " '=") {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		s = s[eq+2:]
+
+		end := 0
+		for ; end < len(s) && s[end] != '\''; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("unterminated value at %q", s)
+		}
+		value, err := Unescape(s[:end])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, Pair{Key: key, Value: value})
+
+		s = s[end+1:]
+		if len(s) > 0 {
+			if s[0] != ' ' {
+				return nil, fmt.Errorf("expected a space at %q", s)
+			}
+			s = s[1:]
+		}
+	}
+	return pairs, nil
+}
+
+// Unescape reverses the escaping of values and of the id and description
+// segments.
+func Unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("dangling backslash in %q", s)
+		}
+		i++
+		switch c := s[i]; c {
+		case '\\', '\'', '|':
+			out.WriteByte(c)
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'x', 'u', 'U':
+			digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+			if i+digits >= len(s) {
+				return "", fmt.Errorf("short escape in %q", s)
+			}
+			n, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+			if c == 'x' {
+				out.WriteByte(byte(n))
+			} else {
+				out.WriteRune(rune(n))
+			}
+			i += digits
+		default:
+			return "", fmt.Errorf("unknown escape \\%c in %q", c, s)
+		}
+	}
+	return out.String(), nil
+}
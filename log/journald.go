@@ -0,0 +1,209 @@
+package log
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// journaldSocket is where journald listens for the native protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// JournaldConfig - journald sink config. Default/unset values for each
+// attribute are safe.
+type JournaldConfig struct {
+	// Socket defaults to /run/systemd/journal/socket.
+	Socket string
+	// Identifier is sent as SYSLOG_IDENTIFIER for events without a golog_id.
+	// Defaults to the program name.
+	Identifier string
+}
+
+// NewJournaldSink returns a sink writing each event to journald using its
+// native protocol. The level is sent as PRIORITY, the golog_id as
+// SYSLOG_IDENTIFIER, the caller as CODE_FILE and CODE_LINE, and every other
+// key/value as an uppercased journal field, prefixed with GOLOG_ if it would
+// take one of those names, e.g. GOLOG_MESSAGE for a message key.
+func NewJournaldSink(conf JournaldConfig) (Sink, error) {
+	if conf.Socket == "" {
+		conf.Socket = journaldSocket
+	}
+	if conf.Identifier == "" {
+		conf.Identifier = filepath.Base(os.Args[0])
+	}
+
+	w, err := DialJournald(conf.Socket)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	return Sink{
+		Output:    w,
+		Level:     defaultLevel,
+		Formatter: FormatterFunc(conf.format),
+	}, nil
+}
+
+func (conf JournaldConfig) format(e Event) string {
+	fields := e.Fields()
+	id, fields := popField(fields, "golog_id")
+	if id == "" {
+		id = conf.Identifier
+	}
+
+	var entry strings.Builder
+	writeJournalField(&entry, "MESSAGE", e.Message)
+	writeJournalField(&entry, "PRIORITY", string(rune('0'+syslogSeverities[e.Level])))
+	writeJournalField(&entry, "SYSLOG_IDENTIFIER", id)
+	for _, f := range fields {
+		switch f.Key {
+		case "file":
+			writeJournalField(&entry, "CODE_FILE", f.Value)
+		case "line":
+			writeJournalField(&entry, "CODE_LINE", f.Value)
+		default:
+			name := journalFieldName(f.Key)
+			if journalOwnFields[name] {
+				// Keep the sink's own, which journald would otherwise keep
+				// alongside, as a second value.
+				name = journalFieldName("GOLOG_" + name)
+			}
+			writeJournalField(&entry, name, f.Value)
+		}
+	}
+	// The logger terminates the entry with the final newline.
+	return strings.TrimSuffix(entry.String(), "\n")
+}
+
+// journalOwnFields are the fields the sink writes itself.
+var journalOwnFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+}
+
+// writeJournalField appends a field in the native protocol: KEY=value for
+// single line values, and KEY, the little endian 64 bit length and the raw
+// value otherwise.
+func writeJournalField(entry *strings.Builder, name, value string) {
+	if !strings.Contains(value, "\n") {
+		entry.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	entry.WriteString(name + "\n")
+	entry.Write(size[:])
+	entry.WriteString(value + "\n")
+}
+
+// journalFieldName makes key a valid journal field name: uppercase letters,
+// digits and underscores, not starting with an underscore (reserved for
+// trusted fields) or digit, at most 64 characters long.
+func journalFieldName(key string) string {
+	name := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c >= 'a' && c <= 'z':
+			name = append(name, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			name = append(name, c)
+		default:
+			name = append(name, '_')
+		}
+	}
+
+	trimmed := strings.TrimLeft(string(name), "_")
+	if trimmed == "" || trimmed[0] >= '0' && trimmed[0] <= '9' {
+		trimmed = "FIELD_" + trimmed
+	}
+	if len(trimmed) > 64 {
+		trimmed = trimmed[:64]
+	}
+	return trimmed
+}
+
+// JournaldWriter is an io.WriteCloser sending each Write as one journal entry
+// in the native protocol. Entries too large for a datagram are passed to
+// journald as a file descriptor instead, where the platform supports it.
+type JournaldWriter struct {
+	socket string
+
+	mu     sync.Mutex
+	conn   *net.UnixConn
+	closed bool
+}
+
+// DialJournald connects to the journald native protocol socket.
+func DialJournald(socket string) (*JournaldWriter, error) {
+	w := &JournaldWriter{socket: socket}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *JournaldWriter) connect() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write sends p as a single entry. p must be in the native protocol, as
+// produced by the journald sink's formatter.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err := w.conn.Write(p)
+	if isMessageTooLarge(err) {
+		err = sendJournalFd(w.conn, p)
+	} else if err != nil {
+		// journald may have restarted and replaced the socket, so retry once
+		// on a fresh connection.
+		w.conn.Close()
+		w.conn = nil
+		if err = w.connect(); err == nil {
+			_, err = w.conn.Write(p)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *JournaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// memfdCreate is the memfd_create syscall number, which the syscall package
+// doesn't define on every architecture. Zero where unknown.
+var memfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+	"mips64":   5314,
+	"mips64le": 5314,
+}[runtime.GOARCH]
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	fSealAll        = 0x1 | 0x2 | 0x4 | 0x8 // seal, shrink, grow, write
+)
+
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalFd passes entry to journald as a file descriptor, the way
+// sd_journal_send does for entries too large for a datagram: a sealed memfd,
+// or an unlinked temporary file if memfds aren't available.
+func sendJournalFd(conn *net.UnixConn, entry []byte) error {
+	file, err := journalMemfd(entry)
+	if err != nil {
+		if file, err = journalTempFile(entry); err != nil {
+			return err
+		}
+	}
+	defer file.Close()
+
+	// WriteMsgUnix refuses connected datagram sockets, so send on the raw fd.
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(file.Fd()))
+	var sendErr error
+	if err := raw.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return sendErr != syscall.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+func journalMemfd(entry []byte) (*os.File, error) {
+	if memfdCreate == 0 {
+		return nil, syscall.ENOSYS
+	}
+
+	name, err := syscall.BytePtrFromString("journal-entry")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(memfdCreate, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	file := os.NewFile(fd, "journal-entry")
+	if _, err := file.Write(entry); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealAll); errno != 0 {
+		file.Close()
+		return nil, errno
+	}
+	return file, nil
+}
+
+func journalTempFile(entry []byte) (*os.File, error) {
+	file, err := os.CreateTemp("/dev/shm", "journal-entry-")
+	if err != nil {
+		if file, err = os.CreateTemp("", "journal-entry-"); err != nil {
+			return nil, err
+		}
+	}
+	// journald only accepts files that aren't linked anywhere.
+	os.Remove(file.Name())
+
+	if _, err := file.Write(entry); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournaldLargeEntries(t *testing.T) {
+	resetLogging(t)
+	server, path := listenJournald(t)
+	sink, err := NewJournaldSink(JournaldConfig{Socket: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload := strings.Repeat("x", 4<<20)
+	New(Config{Sinks: []Sink{sink}}).Error("big", "payload", payload)
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := server.ReadMsgUnix(make([]byte, 1), oob)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("got %d bytes of payload, want the entry passed as a fd only", n)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("unexpected control messages %v: %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("unexpected fds %v: %v", fds, err)
+	}
+
+	if target, _ := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fds[0])); !strings.HasPrefix(target, "/memfd:journal-entry") {
+		t.Errorf("got fd for %q, want a memfd", target)
+	}
+	file := os.NewFile(uintptr(fds[0]), "entry")
+	defer file.Close()
+	entry, err := io.ReadAll(io.NewSectionReader(file, 0, 8<<20))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := parseJournalEntry(t, entry); got["PAYLOAD"] != payload || got["MESSAGE"] != "big" {
+		t.Errorf("entry does not round trip, got %d bytes", len(entry))
+	}
+}
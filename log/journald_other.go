@@ -0,0 +1,16 @@
+//go:build !linux
+
+package log
+
+import (
+	"errors"
+	"net"
+)
+
+func isMessageTooLarge(error) bool {
+	return false
+}
+
+func sendJournalFd(*net.UnixConn, []byte) error {
+	return errors.New("golog: passing journal entries as file descriptors is only supported on linux")
+}
@@ -0,0 +1,177 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseJournalEntry decodes an entry in the journald native protocol.
+func parseJournalEntry(t *testing.T, entry []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(entry) > 0 {
+		i := bytes.IndexAny(entry, "=\n")
+		if i < 0 {
+			t.Fatalf("truncated entry %q", entry)
+		}
+		name := string(entry[:i])
+		if entry[i] == '=' {
+			end := bytes.IndexByte(entry, '\n')
+			fields[name] = string(entry[i+1 : end])
+			entry = entry[end+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(entry[i+1 : i+9])
+		fields[name] = string(entry[i+9 : i+9+int(size)])
+		entry = entry[i+9+int(size)+1:]
+	}
+	return fields
+}
+
+func listenJournald(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram not supported: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+func TestJournaldSink(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("maps events to journal fields", func(t *testing.T) {
+		resetLogging(t)
+		SetStackTrace(true)
+		server, path := listenJournald(t)
+		sink, err := NewJournaldSink(JournaldConfig{Socket: path})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		New(Config{ID: "db", Sinks: []Sink{sink}}, "region", "us").
+			Warn("slow query", "latency-ms", 200, "_trusted", "no", "query", "SELECT 1\nFROM dual")
+
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 65536)
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if bytes.HasSuffix(buf[:n], []byte("\n\n")) {
+			t.Errorf("entry %q ends with an empty line", buf[:n])
+		}
+		fields := parseJournalEntry(t, buf[:n])
+
+		want := map[string]string{
+			"MESSAGE":           "slow query",
+			"PRIORITY":          "4",
+			"SYSLOG_IDENTIFIER": "db",
+			"REGION":            "us",
+			"LATENCY_MS":        "200",
+			"TRUSTED":           "no",
+			"QUERY":             "SELECT 1\nFROM dual",
+			"CODE_FILE":         "journald_test.go",
+		}
+		for name, value := range want {
+			if fields[name] != value {
+				t.Errorf("%s: got %q, want %q", name, fields[name], value)
+			}
+		}
+		if fields["CODE_LINE"] == "" {
+			t.Error("missing CODE_LINE")
+		}
+	})
+
+	t.Run("falls back to the configured identifier", func(t *testing.T) {
+		resetLogging(t)
+		server, path := listenJournald(t)
+		sink, err := NewJournaldSink(JournaldConfig{Socket: path, Identifier: "app"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		New(Config{Sinks: []Sink{sink}}).Error("oh no")
+
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 65536)
+		n, _ := server.Read(buf)
+		if got := parseJournalEntry(t, buf[:n]); got["SYSLOG_IDENTIFIER"] != "app" || got["PRIORITY"] != "3" {
+			t.Errorf("got %v", got)
+		}
+	})
+
+	t.Run("renames fields named as the sink's own", func(t *testing.T) {
+		resetLogging(t)
+		server, path := listenJournald(t)
+		sink, err := NewJournaldSink(JournaldConfig{Socket: path})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		New(Config{ID: "db", Sinks: []Sink{sink}}).
+			Info("msg", "message", "theirs", "priority", "high", "syslog.identifier", "them", "code_line", "1")
+
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 65536)
+		n, _ := server.Read(buf)
+		for _, name := range []string{"MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER"} {
+			if got := strings.Count("\n"+string(buf[:n]), "\n"+name+"="); got != 1 {
+				t.Errorf("got %d %s fields, want 1", got, name)
+			}
+		}
+		fields := parseJournalEntry(t, buf[:n])
+
+		want := map[string]string{
+			"MESSAGE":                 "msg",
+			"PRIORITY":                "6",
+			"SYSLOG_IDENTIFIER":       "db",
+			"GOLOG_MESSAGE":           "theirs",
+			"GOLOG_PRIORITY":          "high",
+			"GOLOG_SYSLOG_IDENTIFIER": "them",
+			"GOLOG_CODE_LINE":         "1",
+		}
+		for name, value := range want {
+			if fields[name] != value {
+				t.Errorf("%s: got %q, want %q", name, fields[name], value)
+			}
+		}
+		if fields["CODE_LINE"] == "1" {
+			t.Error("CODE_LINE was overridden")
+		}
+	})
+
+	t.Run("sanitizes field names", func(t *testing.T) {
+		for key, want := range map[string]string{
+			"simple":                "SIMPLE",
+			"with.dots-dashes":      "WITH_DOTS_DASHES",
+			"__leading":             "LEADING",
+			"9lives":                "FIELD_9LIVES",
+			"":                      "FIELD_",
+			strings.Repeat("a", 70): strings.Repeat("A", 64),
+		} {
+			if got := journalFieldName(key); got != want {
+				t.Errorf("journalFieldName(%q) = %q, want %q", key, got, want)
+			}
+		}
+	})
+
+	t.Run("fails writes after Close", func(t *testing.T) {
+		_, path := listenJournald(t)
+		w, err := DialJournald(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		w.Close()
+		if _, err := w.Write([]byte("MESSAGE=x\n")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
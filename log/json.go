@@ -0,0 +1,90 @@
+package log
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonObject is a JSON object that keeps its keys in the order they were first
+// set, where a marshaled map would sort them, so that the JSON formats can
+// follow the logger's field order. Values are strings, bools, ints or nested
+// objects.
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func newJsonObject() *jsonObject {
+	return &jsonObject{values: make(map[string]any)}
+}
+
+// set sets key to value. A key set already keeps its place.
+func (o *jsonObject) set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// setFields sets every field, in order.
+func (o *jsonObject) setFields(fields []Field) {
+	for _, f := range fields {
+		o.set(f.Key, f.Value)
+	}
+}
+
+func (o *jsonObject) get(key string) (any, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+func (o *jsonObject) delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (o *jsonObject) len() int {
+	return len(o.keys)
+}
+
+func (o *jsonObject) String() string {
+	var b strings.Builder
+	o.writeTo(&b)
+	return b.String()
+}
+
+func (o *jsonObject) writeTo(b *strings.Builder) {
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(jsonString(key))
+		b.WriteByte(':')
+
+		switch value := o.values[key].(type) {
+		case *jsonObject:
+			value.writeTo(b)
+		case string:
+			b.WriteString(jsonString(value))
+		default:
+			// Only bools and ints otherwise, which can't fail to marshal.
+			encoded, _ := json.Marshal(value)
+			b.Write(encoded)
+		}
+	}
+	b.WriteByte('}')
+}
+
+func jsonString(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// formatLogEventAsLogfmt formats an event as a logfmt line:
+//
+//	ts=2014-06-01T15:04:05.000Z level=error id=db msg="could not connect" url=http://timehop.com/
+//
+// Values are quoted, with Go-style escapes, only when they would otherwise be
+// ambiguous.
+func (o formatOptions) formatLogEventAsLogfmt(e Event) string {
+	fields := e.Fields()
+	id, fields := popField(fields, "golog_id")
+
+	var line strings.Builder
+	writeLogfmtPair(&line, o.name(o.names.Time, "ts"), o.formatTime(e.Time, "2006-01-02T15:04:05.000Z07:00"))
+	writeLogfmtPair(&line, o.name(o.names.Level, "level"), strings.ToLower(string(e.Level)))
+	if id != "" {
+		writeLogfmtPair(&line, o.name(o.names.ID, "id"), id)
+	}
+	writeLogfmtPair(&line, o.name(o.names.Message, "msg"), e.Message)
+	for _, f := range fields {
+		writeLogfmtPair(&line, f.Key, f.Value)
+	}
+	return line.String()
+}
+
+func writeLogfmtPair(line *strings.Builder, key, value string) {
+	if line.Len() > 0 {
+		line.WriteByte(' ')
+	}
+	line.WriteString(logfmtKey(key))
+	line.WriteByte('=')
+	line.WriteString(logfmtValue(value))
+}
+
+// logfmtKey replaces the characters a key can't hold, spaces, '=', '"' and
+// control characters, with underscores.
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes value if it's empty or contains a space, '=', '"', a
+// control character or invalid UTF-8.
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	needsQuotes := !utf8.ValidString(value) || strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || unicode.IsControl(r) || !unicode.IsPrint(r)
+	}) >= 0
+	if !needsQuotes {
+		return value
+	}
+
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i, r := range value {
+		switch {
+		case r == utf8.RuneError && !strings.HasPrefix(value[i:], "\uFFFD"):
+			// Invalid UTF-8 can't round trip, so mark it like strconv.Quote does.
+			fmt.Fprintf(&quoted, `\x%02x`, value[i])
+		case r == '"' || r == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteRune(r)
+		case r == '\n':
+			quoted.WriteString(`\n`)
+		case r == '\r':
+			quoted.WriteString(`\r`)
+		case r == '\t':
+			quoted.WriteString(`\t`)
+		case (unicode.IsControl(r) || !unicode.IsPrint(r) && r != ' ') && r > 0xffff:
+			fmt.Fprintf(&quoted, `\U%08x`, r)
+		case unicode.IsControl(r) || !unicode.IsPrint(r) && r != ' ':
+			fmt.Fprintf(&quoted, `\u%04x`, r)
+		default:
+			quoted.WriteRune(r)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
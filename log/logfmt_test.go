@@ -0,0 +1,157 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type logfmtPair struct {
+	key   string
+	value string
+}
+
+// parseLogfmt is a strict logfmt parser: bare values run until the next
+// space, quoted values use Go escapes.
+func parseLogfmt(line string) ([]logfmtPair, error) {
+	var pairs []logfmtPair
+	for len(line) > 0 {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || strings.ContainsAny(line[:eq], " \"") {
+			return nil, fmt.Errorf("expected key at %q", line)
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("unterminated quote in %q", line)
+			}
+			unquoted, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad quoted value %q: %v", line[:end+1], err)
+			}
+			value = unquoted
+			line = line[end+1:]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			value = line[:end]
+			if strings.ContainsAny(value, "=\"") {
+				return nil, fmt.Errorf("unquoted value %q needs quotes", value)
+			}
+			line = line[end:]
+		}
+		pairs = append(pairs, logfmtPair{key, value})
+
+		if len(line) > 0 {
+			if line[0] != ' ' {
+				return nil, fmt.Errorf("expected space at %q", line)
+			}
+			line = line[1:]
+		}
+	}
+	return pairs, nil
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("formats events as logfmt", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		logger := New(Config{Format: LogfmtFormat, ID: "db"}, "region", "us east")
+		logger.SetOutput(output)
+
+		before := time.Now().Truncate(time.Millisecond)
+		logger.Error("could not connect", "url", "http://timehop.com/", "empty", "")
+
+		line := strings.TrimSuffix(output.String(), "\n")
+		pairs, err := parseLogfmt(line)
+		if err != nil {
+			t.Fatalf("unparseable line %q: %v", line, err)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, pairs[0].value)
+		if pairs[0].key != "ts" || err != nil || ts.Before(before) {
+			t.Errorf("got %v, want a timestamp: %v", pairs[0], err)
+		}
+		want := ` level=error id=db msg="could not connect" region="us east" url=http://timehop.com/ empty=""`
+		if got := line[strings.IndexByte(line, ' '):]; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("is selected by LOG_ENCODING", func(t *testing.T) {
+		resetLogging(t)
+		t.Setenv("LOG_ENCODING", "logfmt")
+		initLogging()
+		if got := SanitizeFormat(""); got != LogfmtFormat {
+			t.Errorf("got %v, want %v", got, LogfmtFormat)
+		}
+	})
+
+	t.Run("puts the prefix in a field", func(t *testing.T) {
+		resetLogging(t)
+		t.Setenv("LOG_PREFIX", "host1")
+		initLogging()
+		output := new(bytes.Buffer)
+		logger := New(Config{Format: LogfmtFormat})
+		logger.SetOutput(output)
+
+		logger.Info("msg")
+
+		if !strings.HasPrefix(output.String(), "ts=") || !strings.Contains(output.String(), " prefix=host1") {
+			t.Errorf("got %q", output.String())
+		}
+	})
+
+	t.Run("sanitizes keys", func(t *testing.T) {
+		for key, want := range map[string]string{"a b": "a_b", "a=b": "a_b", `a"b`: `a_b`, "a\nb": "a_b", "": "_", "ключ": "ключ"} {
+			if got := logfmtKey(key); got != want {
+				t.Errorf("logfmtKey(%q) = %q, want %q", key, got, want)
+			}
+		}
+	})
+}
+
+func FuzzLogfmtRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		"", "plain", "with space", "a=b", `"quoted"`, `back\slash`, "new\nline", "tab\there",
+		"\x1b[31mred\x1b[0m", "\xff\xfe invalid", " ", "emoji 🎉", `x' admin='true`, "\x00",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		line := formatOptions{}.formatLogEventAsLogfmt(testEvent(0, LevelInfoName, value, nil, "key", value))
+		if strings.ContainsAny(line, "\n\r") {
+			t.Fatalf("line %q spans several lines", line)
+		}
+
+		pairs, err := parseLogfmt(line)
+		if err != nil {
+			t.Fatalf("unparseable line %q: %v", line, err)
+		}
+		if len(pairs) != 4 {
+			t.Fatalf("got %d pairs from %q, want 4", len(pairs), line)
+		}
+		if pairs[2].key != "msg" || pairs[2].value != value {
+			t.Errorf("msg: got %q, want %q", pairs[2].value, value)
+		}
+		if pairs[3].key != "key" || pairs[3].value != value {
+			t.Errorf("key: got %q, want %q", pairs[3].value, value)
+		}
+	})
+}
@@ -30,10 +30,32 @@
 //
 //	ERROR | MyLibrary | Could not connect to server. | url='http://timehop.com/' error='timed out'
 //	INFO  | MyLibrary | Something happened.
+//
+// # Escaping
+//
+// The text formats escape everything a caller passes in, so that a single
+// event always renders as exactly one line whose fields can't be forged:
+//
+//	line    = [prefix] level " | " [id " | "] description [" | " pairs]
+//	pairs   = pair *(" " pair)
+//	pair    = key "='" value "'"
+//
+// Keys have spaces, equals signs, quotes and non-printable characters replaced
+// with underscores. Values, and the id and description segments, have ANSI escape sequences
+// removed and these escapes applied:
+//
+//	\\      backslash
+//	\'      single quote (values only)
+//	\|      pipe (id and description only)
+//	\n \r \t
+//	\xHH    any other ASCII control character, or a byte of invalid UTF-8
+//	\uHHHH  any other non-printable character, or \UHHHHHHHH beyond U+FFFF
+//
+// So a segment never contains " | " and a value never contains an unescaped
+// quote. KeyValueFormat quotes and escapes its channel and message like values.
 package log
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -68,6 +90,15 @@ const (
 	LevelTraceName LogLevelName = "TRACE"
 )
 
+var levelNames = map[LogLevel]LogLevelName{
+	LevelFatal: LevelFatalName,
+	LevelError: LevelErrorName,
+	LevelWarn:  LevelWarnName,
+	LevelInfo:  LevelInfoName,
+	LevelDebug: LevelDebugName,
+	LevelTrace: LevelTraceName,
+}
+
 const (
 	FlagsNone          = 0
 	FlagsDate          = log.Ldate
@@ -86,6 +117,11 @@ var (
 	defaultOutput     io.Writer
 	defaultLevel      LogLevel
 	defaultFlags      int
+	defaultTemplate   string
+	defaultClock      Clock
+
+	// envFile is the output opened from LOG_FILE, if any.
+	envFile *RotatingFile
 )
 
 func init() {
@@ -99,8 +135,22 @@ func init() {
 
 func initLogging() {
 	defaultPrefix = os.Getenv("LOG_PREFIX")
+	defaultClock = nil
 	defaultOutput = os.Stdout
 
+	if envFile != nil {
+		envFile.Close()
+		envFile = nil
+	}
+	if filename := os.Getenv("LOG_FILE"); filename != "" {
+		if file, err := NewRotatingFile(rotateConfigFromEnv(filename)); err == nil {
+			envFile = file
+			defaultOutput = file
+		} else {
+			fmt.Fprintf(os.Stderr, "golog: could not open LOG_FILE, writing to stdout: %v\n", err)
+		}
+	}
+
 	defaultLevel = LevelInfo
 	switch LogLevelName(os.Getenv("LOG_LEVEL")) {
 	case LevelFatalName:
@@ -121,6 +171,15 @@ func initLogging() {
 		defaultFlags = flags
 	}
 
+	defaultTemplate = DefaultTemplate
+	if text := os.Getenv("LOG_TEMPLATE"); text != "" {
+		if _, err := NewTemplateFormatter(text); err == nil {
+			defaultTemplate = text
+		} else {
+			fmt.Fprintf(os.Stderr, "golog: invalid LOG_TEMPLATE, using the default template: %v\n", err)
+		}
+	}
+
 	if trace, err := strconv.ParseBool(os.Getenv("LOG_STACK_TRACE")); err == nil {
 		defaultStackTrace = trace
 	} else {
@@ -198,6 +257,15 @@ func SetStackTrace(trace bool) {
 	defaultStackTrace = trace
 }
 
+// SetClock changes the clock new loggers tell the time with, unless their
+// Config sets one. Nil restores the system clock.
+//
+// Like SetPrefix, it recreates DefaultLogger to pick up the clock.
+func SetClock(clock Clock) {
+	defaultClock = clock
+	DefaultLogger = NewDefault()
+}
+
 // SetOutput sets the output destination for the default logger.
 //
 // All new logger instances created after this call will use the provided
@@ -235,6 +303,53 @@ type Logger interface {
 type Config struct {
 	Format LogFormat
 	ID     string
+
+	// Sinks, when set, replace the single output described by Format with one
+	// output per sink, each with its own writer, format and level. Format and
+	// Formatter are ignored in that case.
+	Sinks []Sink
+
+	// TimeFormat replaces the timestamp of every format but ecs and
+	// cloud_logging, whose schemas fix it: a time.Format layout, such as
+	// TimeFormatRFC3339Nano, or one of the TimeFormatEpoch units. The text
+	// formats then write it where the date and time flags put the stdlib
+	// logger's, or first, when the flags ask for none.
+	TimeFormat string
+	// TimeLocation is the time zone timestamps are written in, e.g. time.UTC.
+	// Nil keeps each format's own.
+	TimeLocation *time.Location
+	// FieldNames renames the keys of the json, key_value and logfmt formats.
+	FieldNames FieldNames
+
+	// SortFields writes fields sorted by key, rather than in the order they were
+	// set: static fields first, in the order New and SetStaticField got them,
+	// then the call's.
+	SortFields bool
+	// PriorityFields are written before any other field, in the order given.
+	PriorityFields []string
+
+	// Clock tells the time of each event, in every format, including the
+	// timestamp the stdlib log flags ask for. Nil uses the clock set with
+	// SetClock, or the system clock.
+	Clock Clock
+	// Deterministic makes output reproducible, for golden-file tests: events
+	// happen at DeterministicTime unless Clock is set, fields are sorted, and
+	// the caller's file and line are left out.
+	Deterministic bool
+	// ExitFunc is called by Fatal once the event is written. Nil exits the
+	// process with os.Exit.
+	ExitFunc func(code int)
+	// CallerSkip is how many more stack frames to skip to find the caller's
+	// file and line, for loggers wrapped in helpers of their own.
+	CallerSkip int
+
+	// Formatter, when set, replaces Format. See Sink.Formatter.
+	Formatter Formatter
+	// Template is the text/template layout of TemplateFormat, described by
+	// NewTemplateFormatter. It defaults to LOG_TEMPLATE, then DefaultTemplate.
+	// Sinks fall back to DefaultTemplate if it's invalid, with a warning on
+	// stderr; ValidateConfig reports it as an error.
+	Template string
 }
 
 type LogFormat string
@@ -244,39 +359,31 @@ const (
 	PlainTextFormat LogFormat = "text"
 	JsonFormat      LogFormat = "json"
 	KeyValueFormat  LogFormat = "key_value"
+	LogfmtFormat    LogFormat = "logfmt"
+	// ConsoleFormat colors PlainTextFormat for terminals. It falls back to
+	// PlainTextFormat when the output isn't a terminal, or NO_COLOR is set.
+	ConsoleFormat LogFormat = "console"
+	// PrettyFormat prints each key/value on its own line, with multi-line
+	// values and JSON indented, for reading large fields during development.
+	PrettyFormat LogFormat = "pretty"
+	// EcsFormat writes Elastic Common Schema JSON documents.
+	EcsFormat LogFormat = "ecs"
+	// CloudLoggingFormat writes the structured JSON Google Cloud Logging
+	// parses from stdout, correlating traces in the GOOGLE_CLOUD_PROJECT
+	// project.
+	CloudLoggingFormat LogFormat = "cloud_logging"
+	// TemplateFormat lays out each line with Config.Template.
+	TemplateFormat LogFormat = "template"
 )
 
 // New creates a new logger instance.
 func New(conf Config, staticKeysAndValues ...any) Logger {
-	var prefix string
-	var flags int
-	var formatter formatLogEvent
-	staticArgs := make(map[string]string)
-
-	format := SanitizeFormat(conf.Format)
-	if format == JsonFormat {
-		formatter = formatLogEventAsJson
-
-		// Don't mess up the json by letting logger print these:
-		prefix = ""
-		flags = 0
-
-		// Instead put them into the staticArgs
-		if defaultPrefix != "" {
-			staticArgs["prefix"] = defaultPrefix
-		}
-	} else if format == KeyValueFormat {
-		formatter = formatLogEventAsKeyValue
-	} else {
-		formatter = formatLogEventAsPlainText
-		prefix = defaultPrefix
-		flags = defaultFlags
-	}
+	var staticArgs []Field
 
 	// Set 'ID' config as a static field, but before reading the varargs supplied
 	// fields, so that they can override the config.
 	if conf.ID != "" {
-		staticArgs["golog_id"] = conf.ID
+		staticArgs = withField(staticArgs, "golog_id", conf.ID)
 	}
 
 	if len(staticKeysAndValues)%2 == 1 {
@@ -295,23 +402,47 @@ func New(conf Config, staticKeysAndValues ...any) Logger {
 		if i%2 == 0 {
 			currentKey = fmt.Sprintf("%v", arg)
 		} else {
-			staticArgs[currentKey] = fmt.Sprintf("%v", arg)
+			staticArgs = withField(staticArgs, currentKey, fmt.Sprintf("%v", arg))
 		}
 	}
 
+	// Without explicit sinks, the logger writes to a single sink built from the
+	// package defaults, gated only by the logger's own level.
+	level := defaultLevel
+	sinkConfs := conf.Sinks
+	if len(sinkConfs) == 0 {
+		sinkConfs = []Sink{{Format: conf.Format, Formatter: conf.Formatter, Level: LevelTrace, Flags: defaultFlags}}
+	} else {
+		level = LogLevel(-1)
+		for _, sinkConf := range sinkConfs {
+			if sinkConf.Level > level {
+				level = sinkConf.Level
+			}
+		}
+	}
+
+	if conf.Deterministic {
+		conf.SortFields = true
+	}
+
+	opts := newFormatOptions(conf)
+	sinks := make([]*sink, len(sinkConfs))
+	for i, sinkConf := range sinkConfs {
+		sinks[i] = newSink(sinkConf, opts)
+	}
+
 	return &logger{
+		depth:      conf.CallerSkip,
 		stackTrace: defaultStackTrace,
 
-		level: defaultLevel,
+		level: level,
 
-		formatLogEvent: formatter,
-		staticArgs:     staticArgs,
-
-		// don't touch the default logger on 'log' package
-		// cache args to make a logger, in case it's changes with SetOutput()
-		prefix: prefix,
-		flags:  flags,
-		l:      log.New(defaultOutput, prefix, flags),
+		staticArgs: staticArgs,
+		order:      newFieldOrder(conf),
+		noCaller:   conf.Deterministic,
+		exit:       conf.ExitFunc,
+		opts:       opts,
+		sinks:      sinks,
 	}
 }
 
@@ -319,27 +450,51 @@ func NewDefault() Logger {
 	return New(Config{})
 }
 
+// ValidateConfig returns an error for the settings New works around rather
+// than fails on: a Template that NewTemplateFormatter rejects, which sinks
+// replace with DefaultTemplate. Call it before New to refuse them instead.
+func ValidateConfig(conf Config) error {
+	if conf.Template == "" {
+		return nil
+	}
+	if err := compileTemplate(conf.Template).err; err != nil {
+		return fmt.Errorf("golog: invalid Config.Template: %w", err)
+	}
+	return nil
+}
+
 func SanitizeFormat(format LogFormat) LogFormat {
-	if format == PlainTextFormat || format == JsonFormat || format == KeyValueFormat {
+	if isKnownFormat(format) {
 		return format
 	}
 
 	// Whether it's explicitly a DefaultFormat, or it's an unrecognized value,
 	// try to take from env var.
-	envFormat := os.Getenv("LOG_ENCODING")
-	if envFormat == string(JsonFormat) || envFormat == string(PlainTextFormat) || envFormat == string(KeyValueFormat) {
-		return LogFormat(envFormat)
+	if envFormat := LogFormat(os.Getenv("LOG_ENCODING")); isKnownFormat(envFormat) {
+		return envFormat
 	}
 
 	// Fall back to text
 	return PlainTextFormat
 }
 
+func isKnownFormat(format LogFormat) bool {
+	return isBuiltinFormat(format) || registeredFormat(format) != nil
+}
+
+func isBuiltinFormat(format LogFormat) bool {
+	switch format {
+	case PlainTextFormat, JsonFormat, KeyValueFormat, LogfmtFormat, ConsoleFormat, PrettyFormat, EcsFormat, CloudLoggingFormat, TemplateFormat:
+		return true
+	}
+	return false
+}
+
 // Logger represents a logger, through which output is generated.
 //
 // It holds an ID, the minimum severity level to generate output (all calls
-// with inferior severity will yield no effect) and wraps the underlying
-// logger, which is a standard lib's *log.Logger instance.
+// with inferior severity will yield no effect) and the sinks the output is
+// written to, each wrapping a standard lib's *log.Logger instance.
 type logger struct {
 	mu         sync.RWMutex
 	depth      int
@@ -347,12 +502,12 @@ type logger struct {
 
 	level LogLevel
 
-	formatLogEvent formatLogEvent
-	staticArgs     map[string]string
-
-	prefix string
-	flags  int
-	l      *log.Logger
+	staticArgs []Field
+	order      *fieldOrder
+	noCaller   bool
+	exit       func(code int)
+	opts       formatOptions
+	sinks      []*sink
 }
 
 // Fatal outputs an error message with an optional list of key/value pairs and exits
@@ -367,8 +522,12 @@ func (s *logger) fatal(depth int, description string, keysAndValues ...any) {
 	if below {
 		return
 	}
-	s.logMessage(depth+1, LevelFatalName, description, keysAndValues...)
-	osExit(1)
+	s.logMessage(depth+1, LevelFatal, description, keysAndValues...)
+	if s.exit != nil {
+		s.exit(1)
+	} else {
+		osExit(1)
+	}
 }
 
 // Error outputs an error message with an optional list of key/value pairs.
@@ -383,7 +542,7 @@ func (s *logger) error(depth int, description string, keysAndValues ...any) {
 	if below {
 		return
 	}
-	s.logMessage(depth+1, LevelErrorName, description, keysAndValues...)
+	s.logMessage(depth+1, LevelError, description, keysAndValues...)
 }
 
 // Warn outputs a warning message with an optional list of key/value pairs.
@@ -401,7 +560,7 @@ func (s *logger) warn(depth int, description string, keysAndValues ...any) {
 	if below {
 		return
 	}
-	s.logMessage(depth+1, LevelWarnName, description, keysAndValues...)
+	s.logMessage(depth+1, LevelWarn, description, keysAndValues...)
 }
 
 // Info outputs an info message with an optional list of key/value pairs.
@@ -419,7 +578,7 @@ func (s *logger) info(depth int, description string, keysAndValues ...any) {
 	if below {
 		return
 	}
-	s.logMessage(depth+1, LevelInfoName, description, keysAndValues...)
+	s.logMessage(depth+1, LevelInfo, description, keysAndValues...)
 }
 
 // Debug outputs an info message with an optional list of key/value pairs.
@@ -437,7 +596,7 @@ func (s *logger) debug(depth int, description string, keysAndValues ...any) {
 	if below {
 		return
 	}
-	s.logMessage(depth+1, LevelDebugName, description, keysAndValues...)
+	s.logMessage(depth+1, LevelDebug, description, keysAndValues...)
 }
 
 // Trace outputs an info message with an optional list of key/value pairs.
@@ -455,12 +614,12 @@ func (s *logger) trace(depth int, description string, keysAndValues ...any) {
 	if below {
 		return
 	}
-	s.logMessage(depth+1, LevelTraceName, description, keysAndValues...)
+	s.logMessage(depth+1, LevelTrace, description, keysAndValues...)
 }
 
 // Adding caller information
 // https://stackoverflow.com/questions/24809287/how-do-you-get-a-golang-program-to-print-the-line-number-of-the-error-it-just-ca
-func (s *logger) logMessage(depth int, level LogLevelName, description string, keysAndValues ...any) {
+func (s *logger) logMessage(depth int, level LogLevel, description string, keysAndValues ...any) {
 	// If there are an odd number of keysAndValue, then there's probably one
 	// missing, which means we'd interpret a value as a key, which can be bad for
 	// logs-as-data, like metrics on keys or Elasticsearch. But, instead of
@@ -481,15 +640,24 @@ func (s *logger) logMessage(depth int, level LogLevelName, description string, k
 	}
 
 	// hack in caller stats
-	if defaultStackTrace {
-		if _, fn, line, ok := runtime.Caller(depth + 1); ok {
+	if defaultStackTrace && !s.noCaller {
+		if _, fn, line, ok := runtime.Caller(depth + 1 + s.depth); ok {
 			keysAndValues = append(keysAndValues, "file", filepath.Base(fn), "line", strconv.Itoa(line))
 		}
 	}
 
 	s.mu.RLock()
-	msg := s.formatLogEvent(s.flags, level, description, s.staticArgs, keysAndValues...)
-	s.l.Println(msg)
+	e := Event{
+		Time:          s.opts.now(),
+		Level:         levelNames[level],
+		Message:       description,
+		StaticFields:  s.staticArgs,
+		KeysAndValues: keysAndValues,
+		order:         s.order,
+	}
+	for _, sk := range s.sinks {
+		sk.log(level, e)
+	}
 	s.mu.RUnlock()
 }
 
@@ -507,134 +675,82 @@ func (s *logger) SetStackTrace(trace bool) {
 
 // SetOutput sets the output destination for the logger.
 //
-// Useful to change where the log stream ends up being written to.
+// Useful to change where the log stream ends up being written to. On a logger
+// with several sinks, every sink is redirected to w.
 func (s *logger) SetOutput(w io.Writer) {
 	s.mu.Lock()
-	s.l = log.New(w, s.prefix, s.flags)
+	for _, sk := range s.sinks {
+		sk.setOutput(w)
+	}
 	s.mu.Unlock()
 }
 
 // SetTimestampFlags changes the timestamp flags on the output of the logger.
 func (s *logger) SetTimestampFlags(flags int) {
 	s.mu.Lock()
-	s.flags = flags
-	s.l.SetFlags(flags)
+	for _, sk := range s.sinks {
+		sk.flags = flags
+		sk.l.SetFlags(sk.loggerFlags())
+	}
 	s.mu.Unlock()
 }
 
 // SetStaticField Add a key/value field to every log line from this logger.
 func (s *logger) SetStaticField(name string, value any) {
 	s.mu.Lock()
-	s.staticArgs[name] = fmt.Sprintf("%v", value)
+	s.staticArgs = withField(s.staticArgs, name, fmt.Sprintf("%v", value))
 	s.mu.Unlock()
 }
 
-type formatLogEvent func(
-	flags int,
-	level LogLevelName,
-	description string,
-	staticFields map[string]string,
-	extraFieldKeysAndValues ...any,
-) string
-
 // Format is "SEVERITY | Description [| k1='v1' k2='v2' k3=]"
 // with key/value pairs being optional, depending on whether args are provided
-func formatLogEventAsPlainText(flags int, level LogLevelName, description string, staticFields map[string]string, args ...any) string {
+func (o formatOptions) formatLogEventAsPlainText(e Event) string {
 	// A full log statement is <id> | <severity> | <description> | <keys and values>
 	items := make([]string, 0, 8)
 
 	// If there are flags, go's logger will prefix with stuff, so add an empty
 	// initial item as a placeholder, so string join will prefix a separator.
-	if flags > FlagsNone {
+	// Unless the timestamp is ours to write.
+	if ts := o.ownTimestamp(e.Flags, e.Time); ts != "" {
+		items = append(items, ts)
+	} else if e.Flags > FlagsNone && (o.stdlibHeader || !o.ownsTimestamp()) {
 		items = append(items, "")
 	}
 
-	items = append(items, string(level))
+	items = append(items, string(e.Level))
 
-	// Combine args and staticFields, allowing args to override staticFields.
-	// But don't use yet, just use it for ID first.
-	if len(args)+len(staticFields) > 0 {
-		// Prefix with static fields, but make sure to allow args to override static.
-		for key, value := range staticFields {
-			var existsInArgs bool
-
-			for i, arg := range args {
-				if i%2 == 0 && key == arg {
-					existsInArgs = true
-				}
-			}
-
-			if !existsInArgs {
-				args = append([]any{key, value}, args...)
-			}
-		}
-	}
-
-	// Grab ID from args.
-	var id string
-	for i, arg := range args {
-		if i%2 == 0 && fmt.Sprintf("%v", arg) == "golog_id" && i < len(args)-1 {
-			// Set id and remove from fields
-			id = fmt.Sprintf("%v", args[i+1])
-			args = append(args[:i], args[i+2:]...)
-			break
-		}
-	}
+	// Combine args and staticFields, allowing args to override staticFields,
+	// and grab the ID from them.
+	id, fields := popField(e.Fields(), "golog_id")
 	if id != "" {
-		items = append(items, id)
+		items = append(items, escapeTextSegment(id))
 	}
 
-	items = append(items, description)
+	items = append(items, escapeTextSegment(e.Message))
 
-	if len(args) > 0 {
-		items = append(items, expandKeyValuePairs(args))
+	if len(fields) > 0 {
+		items = append(items, expandKeyValuePairs(fields))
 	}
 
 	return strings.Join(items, " | ")
 }
 
-func formatLogEventAsKeyValue(flags int, level LogLevelName, description string, staticFields map[string]string, args ...any) string {
+func (o formatOptions) formatLogEventAsKeyValue(e Event) string {
 	// Example output
 	// level='INFO' channel='LogID' message='Not all those who wander are lost.' hello='world' foo='bar' file='logging_test.go' line_number='1022'
 	items := make([]string, 0, 8)
 
 	// If there are flags, go's logger will prefix with stuff, so add an empty
 	// initial item as a placeholder, so string join will prefix a separator.
-	if flags > FlagsNone {
+	if e.Flags > FlagsNone {
 		items = append(items, "")
 	}
 
-	items = append(items, strconv.Itoa(int(time.Now().Unix())), string(level))
+	items = append(items, o.formatTime(e.Time, TimeFormatEpochSeconds), string(e.Level))
 
-	// Combine args and staticFields, allowing args to override staticFields.
-	// But don't use yet, just use it for ID first.
-	if len(args)+len(staticFields) > 0 {
-		// Prefix with static fields, but make sure to allow args to override static.
-		for key, value := range staticFields {
-			var existsInArgs bool
-
-			for i, arg := range args {
-				if i%2 == 0 && key == arg {
-					existsInArgs = true
-				}
-			}
-
-			if !existsInArgs {
-				args = append([]any{key, value}, args...)
-			}
-		}
-	}
-
-	// Grab ID from args.
-	var id string
-	for i, arg := range args {
-		if i%2 == 0 && fmt.Sprintf("%v", arg) == "golog_id" && i < len(args)-1 {
-			// Set id and remove from fields
-			id = fmt.Sprintf("%v", args[i+1])
-			args = append(args[:i], args[i+2:]...)
-			break
-		}
-	}
+	// Combine args and staticFields, allowing args to override staticFields,
+	// and grab the ID from them.
+	id, fields := popField(e.Fields(), "golog_id")
 
 	// Making sure an ID is always present so that the index logic
 	// below doesn't break
@@ -642,10 +758,10 @@ func formatLogEventAsKeyValue(flags int, level LogLevelName, description string,
 		id = "Golog"
 	}
 
-	items = append(items, id, description)
+	items = append(items, id, e.Message)
 
-	if len(args) > 0 {
-		items = append(items, expandKeyValuePairs(args))
+	if len(fields) > 0 {
+		items = append(items, expandKeyValuePairs(fields))
 	}
 
 	// Use the already formatted and parsed items slice above to create a key_value specific log line
@@ -654,13 +770,13 @@ func formatLogEventAsKeyValue(flags int, level LogLevelName, description string,
 	for i := range items {
 		switch i {
 		case 0:
-			itemsNew[0] = fmt.Sprintf("timestamp='%s'", items[0])
+			itemsNew[0] = fmt.Sprintf("%s='%s'", escapeTextKey(o.name(o.names.Time, "timestamp")), escapeTextValue(items[0]))
 		case 1:
-			itemsNew[1] = fmt.Sprintf("level='%s'", items[1])
+			itemsNew[1] = fmt.Sprintf("%s='%s'", escapeTextKey(o.name(o.names.Level, "level")), items[1])
 		case 2:
-			itemsNew[2] = fmt.Sprintf("channel='%s'", items[2])
+			itemsNew[2] = fmt.Sprintf("%s='%s'", escapeTextKey(o.name(o.names.ID, "channel")), escapeTextValue(items[2]))
 		case 3:
-			itemsNew[3] = fmt.Sprintf("message='%s'", items[3])
+			itemsNew[3] = fmt.Sprintf("%s='%s'", escapeTextKey(o.name(o.names.Message, "message")), escapeTextValue(items[3]))
 		default:
 			itemsNew[i] = items[i]
 		}
@@ -668,56 +784,34 @@ func formatLogEventAsKeyValue(flags int, level LogLevelName, description string,
 	return strings.Join(itemsNew, " ")
 }
 
-// expandKeyValuePairs converts a list of arguments into a string with the
-// format "k='v' foo='bar' bar=".
-func expandKeyValuePairs(keyValuePairs []any) string {
-	kvPairs := make([]string, 0, len(keyValuePairs)/2)
-
-	// Just ignore the last dangling kv if odd #, cuz bug.
-	for i, kv := range keyValuePairs {
-		if i%2 == 1 {
-			kvPairs = append(kvPairs, fmt.Sprintf("%v='%v'", keyValuePairs[i-1], kv))
-		}
+// expandKeyValuePairs converts a list of fields into a string with the
+// format "k='v' foo='bar'", escaped as described in escape.go.
+func expandKeyValuePairs(fields []Field) string {
+	kvPairs := make([]string, len(fields))
+	for i, f := range fields {
+		kvPairs[i] = escapeTextKey(f.Key) + "='" + escapeTextValue(f.Value) + "'"
 	}
 
 	return strings.Join(kvPairs, " ")
 }
 
-func formatLogEventAsJson(_ int, level LogLevelName, msg string, staticFields map[string]string, extraFields ...any) string {
-	entry := jsonLogEntry{
-		Timestamp: time.Now().String(),
-		Level:     level,
-		Message:   msg,
+func (o formatOptions) formatLogEventAsJson(e Event) string {
+	entry := newJsonObject()
+	entry.set(o.name(o.names.Time, "ts"), o.formatTime(e.Time, TimeFormatRFC3339Nano))
+	entry.set(o.name(o.names.Level, "lvl"), string(e.Level))
+	if e.Message != "" {
+		entry.set(o.name(o.names.Message, "msg"), e.Message)
 	}
 
-	// If there are an odd number of keys+values, round up, cuz empty key will still be added.
-	numExtraKeyValuePairs := (len(extraFields) + 1) / 2
-
-	entry.Fields = make(map[string]string, len(staticFields)+numExtraKeyValuePairs)
-	for key, value := range staticFields {
-		entry.Fields[key] = value
-	}
-
-	currentKey := ""
-	for i, field := range extraFields {
-		if i%2 == 0 {
-			currentKey = fmt.Sprintf("%v", field)
-		} else {
-			entry.Fields[currentKey] = fmt.Sprintf("%v", field)
-		}
+	// Fields keep the logger's order. A key given twice keeps its first place
+	// and its last value.
+	if fields := e.Fields(); len(fields) > 0 {
+		object := newJsonObject()
+		object.setFields(fields)
+		entry.set(o.name(o.names.Fields, "fields"), object)
 	}
 
-	// log entry can't fail to marshal, it's just strings, so ignore error for 100% test coverage
-	encodedEntry, _ := json.Marshal(entry)
-
-	return string(encodedEntry)
-}
-
-type jsonLogEntry struct {
-	Timestamp string            `json:"ts"`
-	Level     LogLevelName      `json:"lvl"`
-	Message   string            `json:"msg,omitempty"`
-	Fields    map[string]string `json:"fields,omitempty"`
+	return entry.String()
 }
 
 func flattenKeyValues(keysAndValues []any) string {
@@ -3,7 +3,9 @@ package log
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -17,12 +19,22 @@ func resetLogging(t *testing.T) {
 	t.Setenv("LOG_FORMAT", "0")
 	t.Setenv("LOG_ENCODING", "")
 	t.Setenv("LOG_STACK_TRACE", "false")
+	t.Setenv("LOG_FILE", "")
+	t.Setenv("LOG_TEMPLATE", "")
 
 	initLogging()
 
 	osExit = func(code int) {}
 }
 
+// jsonLogEntry reads back an entry written in JsonFormat.
+type jsonLogEntry struct {
+	Timestamp string            `json:"ts"`
+	Level     LogLevelName      `json:"lvl"`
+	Message   string            `json:"msg,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
 type exitCapture struct {
 	didExit  bool
 	exitCode int
@@ -56,11 +68,11 @@ func TestJsonFormat(t *testing.T) {
 		}
 
 		t.Run("has a timestamp", func(t *testing.T) {
-			start := strings.Index(entry.Timestamp, " m=+")
-			chunk := []byte(entry.Timestamp)[:start]
-			entryTimestamp := string(chunk)
+			if strings.Contains(entry.Timestamp, " m=") {
+				t.Errorf("timestamp %q has a monotonic clock reading", entry.Timestamp)
+			}
 
-			timestamp, err := time.Parse("2006-01-02 15:04:05 -0700 MST", entryTimestamp)
+			timestamp, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -861,3 +873,37 @@ func TestLoggerSetTimestampFlags(t *testing.T) {
 		t.Errorf("output %q does not start with expected content", out)
 	}
 }
+
+func TestExitFunc(t *testing.T) {
+	resetLogging(t)
+	ec := captureExit(t)
+	output := new(bytes.Buffer)
+	SetOutput(output)
+	var code int
+	New(Config{ExitFunc: func(c int) { code = c }}).Fatal("msg")
+
+	if code != 1 {
+		t.Errorf("got exit code %d, want 1", code)
+	}
+	if ec.didExit {
+		t.Error("expected ExitFunc to replace the process exit")
+	}
+	if got := output.String(); got != "FATAL | msg\n" {
+		t.Errorf("got %q, want %q", got, "FATAL | msg\n")
+	}
+}
+
+func TestCallerSkip(t *testing.T) {
+	resetLogging(t)
+	SetStackTrace(true)
+	output := new(bytes.Buffer)
+	SetOutput(output)
+	logger := New(Config{CallerSkip: 1})
+	helper := func() { logger.Info("msg") }
+	_, _, line, _ := runtime.Caller(0)
+	helper()
+
+	if want := fmt.Sprintf("INFO | msg | file='logging_test.go' line='%d'\n", line+1); output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,259 @@
+// Package logtest records what code under test logs, so that tests can assert
+// on events rather than string-match formatted output.
+//
+//	rec := logtest.RecordDefault(t)
+//	DoSomething()
+//	rec.AssertLogged(t, log.LevelError, "Could not connect.", "url", "http://timehop.com/")
+package logtest
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timehop/golog/log"
+)
+
+// logPackage prefixes the names of the log package's functions.
+const logPackage = "github.com/timehop/golog/log."
+
+var levels = map[log.LogLevelName]log.LogLevel{
+	log.LevelFatalName: log.LevelFatal,
+	log.LevelErrorName: log.LevelError,
+	log.LevelWarnName:  log.LevelWarn,
+	log.LevelInfoName:  log.LevelInfo,
+	log.LevelDebugName: log.LevelDebug,
+	log.LevelTraceName: log.LevelTrace,
+}
+
+// Entry is a single recorded event.
+type Entry struct {
+	Time        time.Time
+	Level       log.LogLevel
+	ID          string
+	Description string
+	// Fields are the event's static and call-site fields, without golog_id,
+	// file and line, in the order the logger writes them.
+	Fields []log.Field
+	// File and Line are where the event was logged from.
+	File string
+	Line int
+}
+
+// Field returns the value of the field named key, and whether there's one.
+func (e Entry) Field(key string) (string, bool) {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// String renders the entry as PlainTextFormat would, for failure messages.
+func (e Entry) String() string {
+	var b strings.Builder
+	b.WriteString(string(levelName(e.Level)) + " | ")
+	if e.ID != "" {
+		b.WriteString(e.ID + " | ")
+	}
+	b.WriteString(e.Description)
+	for i, f := range e.Fields {
+		if i == 0 {
+			b.WriteString(" |")
+		}
+		b.WriteString(" " + f.Key + "='" + f.Value + "'")
+	}
+	return b.String()
+}
+
+// Entries is a list of recorded events, with helpers to narrow it down.
+type Entries []Entry
+
+// Filter returns the entries logged at level.
+func (es Entries) Filter(level log.LogLevel) Entries {
+	return es.where(func(e Entry) bool { return e.Level == level })
+}
+
+// WithID returns the entries logged with the golog_id id.
+func (es Entries) WithID(id string) Entries {
+	return es.where(func(e Entry) bool { return e.ID == id })
+}
+
+// WithDescription returns the entries logged with description.
+func (es Entries) WithDescription(description string) Entries {
+	return es.where(func(e Entry) bool { return e.Description == description })
+}
+
+// WithField returns the entries with a field named key whose value prints as
+// value does with %v.
+func (es Entries) WithField(key string, value any) Entries {
+	want := fmt.Sprintf("%v", value)
+	return es.where(func(e Entry) bool {
+		got, ok := e.Field(key)
+		return ok && got == want
+	})
+}
+
+// String lists the entries, one per line.
+func (es Entries) String() string {
+	lines := make([]string, len(es))
+	for i, e := range es {
+		lines[i] = "\t" + e.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (es Entries) where(match func(e Entry) bool) Entries {
+	var matched Entries
+	for _, e := range es {
+		if match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// Recorder is a Logger that records every event it's given, whatever the
+// package level, until SetLevel says otherwise. It still writes them, in
+// TemplateFormat with DefaultTemplate, to its output, which SetOutput changes
+// from io.Discard.
+//
+// Fatal still exits, unless conf.ExitFunc says otherwise.
+type Recorder struct {
+	log.Logger
+
+	mu      sync.Mutex
+	entries Entries
+}
+
+// NewRecorder returns a recorder with conf's ID and field settings, and the
+// given static fields. conf's Format, Formatter and Sinks are ignored.
+func NewRecorder(conf log.Config, staticKeysAndValues ...any) *Recorder {
+	r := &Recorder{}
+
+	formatter, err := log.NewTemplateFormatter(log.DefaultTemplate)
+	if err != nil {
+		panic(err)
+	}
+	conf.Formatter = nil
+	conf.Sinks = []log.Sink{{
+		Output: io.Discard,
+		Level:  log.LevelTrace,
+		Formatter: log.FormatterFunc(func(e log.Event) string {
+			r.record(e)
+			return formatter.Format(e)
+		}),
+	}}
+	r.Logger = log.New(conf, staticKeysAndValues...)
+	return r
+}
+
+// RecordDefault replaces log.DefaultLogger, which the package functions such
+// as log.Info write to, with a recorder until t finishes.
+func RecordDefault(t testing.TB) *Recorder {
+	t.Helper()
+	previous := log.DefaultLogger
+	t.Cleanup(func() { log.DefaultLogger = previous })
+
+	r := NewRecorder(log.Config{})
+	log.DefaultLogger = r.Logger
+	return r
+}
+
+func (r *Recorder) record(e log.Event) {
+	entry := Entry{Time: e.Time, Level: levels[e.Level], Description: e.Message}
+	for _, f := range e.Fields() {
+		switch f.Key {
+		case "golog_id":
+			entry.ID = f.Value
+		case "file", "line":
+		default:
+			entry.Fields = append(entry.Fields, f)
+		}
+	}
+	entry.File, entry.Line = caller()
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+}
+
+// caller returns the file and line the current event was logged from: the
+// first frame outside the log package, past its own.
+func caller() (string, int) {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	inLog := false
+	for {
+		frame, more := frames.Next()
+		switch {
+		case strings.HasPrefix(frame.Function, logPackage):
+			inLog = true
+		case inLog && frame.File != "<autogenerated>":
+			return filepath.Base(frame.File), frame.Line
+		}
+		if !more {
+			return "", 0
+		}
+	}
+}
+
+// Entries returns everything recorded so far.
+func (r *Recorder) Entries() Entries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append(Entries(nil), r.entries...)
+}
+
+// Reset forgets everything recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// AssertLogged fails t unless an event was recorded at level, with
+// description and each of the given key/values.
+func (r *Recorder) AssertLogged(t testing.TB, level log.LogLevel, description string, keysAndValues ...any) {
+	t.Helper()
+	if len(r.matching(level, description, keysAndValues)) == 0 {
+		t.Errorf("logtest: no %s event %q with %v, got:\n%s", levelName(level), description, keysAndValues, r.Entries())
+	}
+}
+
+// AssertNotLogged fails t if an event was recorded at level, with description
+// and each of the given key/values.
+func (r *Recorder) AssertNotLogged(t testing.TB, level log.LogLevel, description string, keysAndValues ...any) {
+	t.Helper()
+	if matched := r.matching(level, description, keysAndValues); len(matched) > 0 {
+		t.Errorf("logtest: unexpected %s event %q with %v, got:\n%s", levelName(level), description, keysAndValues, matched)
+	}
+}
+
+func (r *Recorder) matching(level log.LogLevel, description string, keysAndValues []any) Entries {
+	matched := r.Entries().Filter(level).WithDescription(description)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if key := fmt.Sprintf("%v", keysAndValues[i]); key == "golog_id" {
+			matched = matched.WithID(fmt.Sprintf("%v", keysAndValues[i+1]))
+		} else {
+			matched = matched.WithField(key, keysAndValues[i+1])
+		}
+	}
+	return matched
+}
+
+func levelName(level log.LogLevel) log.LogLevelName {
+	for name, l := range levels {
+		if l == level {
+			return name
+		}
+	}
+	return log.LogLevelName(fmt.Sprintf("level %d", level))
+}
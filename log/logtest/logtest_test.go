@@ -0,0 +1,134 @@
+package logtest
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/timehop/golog/log"
+)
+
+// fakeT records logs and failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	logs      []string
+	failures  []string
+	failedNow bool
+	cleanups  []func()
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Log(args ...any) {
+	f.logs = append(f.logs, fmt.Sprint(args...))
+}
+
+func (f *fakeT) FailNow() {
+	f.failedNow = true
+}
+
+func (f *fakeT) Cleanup(cleanup func()) {
+	f.cleanups = append(f.cleanups, cleanup)
+}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("records structured events", func(t *testing.T) {
+		rec := NewRecorder(log.Config{ID: "db"}, "host", "localhost")
+		_, _, line, _ := runtime.Caller(0)
+		rec.Warn("Slow query.", "ms", 250)
+		rec.Trace("Details.")
+
+		entries := rec.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("got %d entries, want 2", len(entries))
+		}
+		e := entries[0]
+		if e.Level != log.LevelWarn || e.ID != "db" || e.Description != "Slow query." || e.Time.IsZero() {
+			t.Errorf("unexpected entry %+v", e)
+		}
+		if len(e.Fields) != 2 || e.Fields[0] != (log.Field{Key: "host", Value: "localhost"}) || e.Fields[1] != (log.Field{Key: "ms", Value: "250"}) {
+			t.Errorf("got fields %v", e.Fields)
+		}
+		if e.File != "logtest_test.go" || e.Line != line+1 {
+			t.Errorf("got caller %s:%d, want logtest_test.go:%d", e.File, e.Line, line+1)
+		}
+
+		rec.Reset()
+		if got := rec.Entries(); len(got) != 0 {
+			t.Errorf("got %v after a reset", got)
+		}
+	})
+
+	t.Run("narrows entries down", func(t *testing.T) {
+		rec := NewRecorder(log.Config{})
+		rec.Error("Failed.", "user", 1)
+		rec.Error("Failed.", "user", 2)
+		rec.Info("Done.", "user", 1)
+
+		if got := rec.Entries().Filter(log.LevelError); len(got) != 2 {
+			t.Errorf("got %v, want both errors", got)
+		}
+		if got := rec.Entries().Filter(log.LevelError).WithField("user", 1); len(got) != 1 || got[0].Description != "Failed." {
+			t.Errorf("got %v, want the first error", got)
+		}
+		if got := rec.Entries().WithField("user", 3); len(got) != 0 {
+			t.Errorf("got %v, want nothing", got)
+		}
+	})
+
+	t.Run("asserts on events", func(t *testing.T) {
+		rec := NewRecorder(log.Config{ID: "api"})
+		rec.Error("Could not connect.", "url", "http://timehop.com/")
+
+		ft := &fakeT{}
+		rec.AssertLogged(ft, log.LevelError, "Could not connect.", "url", "http://timehop.com/", "golog_id", "api")
+		rec.AssertNotLogged(ft, log.LevelWarn, "Could not connect.")
+		if len(ft.failures) != 0 {
+			t.Errorf("unexpected failures %v", ft.failures)
+		}
+
+		rec.AssertLogged(ft, log.LevelError, "Could not connect.", "url", "http://example.com/")
+		rec.AssertNotLogged(ft, log.LevelError, "Could not connect.")
+		if len(ft.failures) != 2 {
+			t.Fatalf("got failures %v, want 2", ft.failures)
+		}
+		if !strings.Contains(ft.failures[0], "ERROR | api | Could not connect. | url='http://timehop.com/'") {
+			t.Errorf("got %q, want the recorded events listed", ft.failures[0])
+		}
+	})
+
+	t.Run("writes plain text to its output", func(t *testing.T) {
+		rec := NewRecorder(log.Config{})
+		output := new(bytes.Buffer)
+		rec.SetOutput(output)
+		rec.Info("Hello.", "k", "v")
+
+		if got, want := output.String(), "INFO  | Hello. | k='v'"; !strings.HasPrefix(got, want) {
+			t.Errorf("got %q, want it to start with %q", got, want)
+		}
+	})
+}
+
+func TestRecordDefault(t *testing.T) {
+	previous := log.DefaultLogger
+
+	t.Run("swaps the default logger", func(t *testing.T) {
+		rec := RecordDefault(t)
+		log.Debug("cache", "Miss.", "key", "a")
+
+		rec.AssertLogged(t, log.LevelDebug, "Miss.", "golog_id", "cache", "key", "a")
+		if e := rec.Entries()[0]; e.File != "logtest_test.go" {
+			t.Errorf("got caller file %q, want logtest_test.go", e.File)
+		}
+	})
+
+	if log.DefaultLogger != previous {
+		t.Error("the default logger wasn't restored")
+	}
+}
@@ -0,0 +1,160 @@
+package logtest
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/timehop/golog/log"
+)
+
+// New returns a logger writing each event to t.Log, so that it only shows for
+// failing tests, or with -v, under the test or subtest that logged it, at the
+// line that logged it. Every level is written, without timestamp flags.
+//
+// conf's Format and Formatter are used as usual, but Sinks are ignored, and
+// SetOutput does nothing. Fatal stops the test with t.FailNow, rather than
+// exiting the process.
+func New(t testing.TB, conf log.Config, staticKeysAndValues ...any) log.Logger {
+	return newTBLogger(t, false, conf, staticKeysAndValues)
+}
+
+// NewStrict is New, but fails the test when an Error or Fatal is logged, for
+// code that isn't expected to log any.
+func NewStrict(t testing.TB, conf log.Config, staticKeysAndValues ...any) log.Logger {
+	return newTBLogger(t, true, conf, staticKeysAndValues)
+}
+
+// tbLogger logs through a regular logger, then hands each line to t.Log from
+// its own methods, which t.Helper can then skip over along with the caller's
+// helpers. t.Log called from the log package would attribute every line to it.
+type tbLogger struct {
+	log.Logger
+	t      testing.TB
+	strict bool
+
+	// callMu serializes calls, so that each takes the line it wrote, and
+	// nothing else.
+	callMu sync.Mutex
+
+	mu      sync.Mutex
+	level   log.LogLevel
+	line    string
+	written bool
+	done    bool
+	exited  bool
+}
+
+func newTBLogger(t testing.TB, strict bool, conf log.Config, staticKeysAndValues []any) *tbLogger {
+	l := &tbLogger{t: t, strict: strict, level: log.LevelTrace}
+	// Goroutines that outlive the test mustn't call t.Log, which panics then.
+	t.Cleanup(func() {
+		l.mu.Lock()
+		l.done = true
+		l.mu.Unlock()
+	})
+
+	conf.Sinks = []log.Sink{{
+		Output:    tbWriter{l},
+		Format:    conf.Format,
+		Formatter: conf.Formatter,
+		Level:     log.LevelTrace,
+		Flags:     log.FlagsNone,
+	}}
+	// The caller's file and line are those of the tbLogger method's caller.
+	conf.CallerSkip++
+	conf.ExitFunc = func(int) {
+		l.mu.Lock()
+		l.exited = true
+		l.mu.Unlock()
+	}
+	l.Logger = log.New(conf, staticKeysAndValues...)
+	return l
+}
+
+// tbWriter keeps the line a tbLogger's sink writes for the call in progress.
+type tbWriter struct {
+	l *tbLogger
+}
+
+func (w tbWriter) Write(p []byte) (int, error) {
+	w.l.mu.Lock()
+	w.l.line, w.l.written = strings.TrimSuffix(string(p), "\n"), true
+	w.l.mu.Unlock()
+	return len(p), nil
+}
+
+// call logs a single event with logEvent and hands the line it wrote, if any,
+// to t.Log. It returns whether the event asked to exit.
+func (l *tbLogger) call(logEvent func()) (exited bool) {
+	l.t.Helper()
+	l.callMu.Lock()
+	logEvent()
+	l.mu.Lock()
+	line, written, done := l.line, l.written, l.done
+	exited = l.exited
+	l.line, l.written, l.exited = "", false, false
+	l.mu.Unlock()
+	l.callMu.Unlock()
+
+	if written && !done {
+		l.t.Log(line)
+	}
+	return exited
+}
+
+// Fatal logs a fatal message, then stops the test. Like t.FailNow, it must be
+// called from the test's goroutine.
+func (l *tbLogger) Fatal(description string, keysAndValues ...any) {
+	l.t.Helper()
+	if l.call(func() { l.Logger.Fatal(description, keysAndValues...) }) {
+		l.t.FailNow()
+	}
+}
+
+// Error logs an error message, failing the test if the logger is strict and
+// its level lets errors through.
+func (l *tbLogger) Error(description string, keysAndValues ...any) {
+	l.t.Helper()
+	l.call(func() { l.Logger.Error(description, keysAndValues...) })
+
+	l.mu.Lock()
+	failed := l.strict && l.level >= log.LevelError && !l.done
+	l.mu.Unlock()
+	if failed {
+		l.t.Errorf("logtest: unexpected error logged: %s", description)
+	}
+}
+
+func (l *tbLogger) Warn(description string, keysAndValues ...any) {
+	l.t.Helper()
+	l.call(func() { l.Logger.Warn(description, keysAndValues...) })
+}
+
+func (l *tbLogger) Info(description string, keysAndValues ...any) {
+	l.t.Helper()
+	l.call(func() { l.Logger.Info(description, keysAndValues...) })
+}
+
+func (l *tbLogger) Debug(description string, keysAndValues ...any) {
+	l.t.Helper()
+	l.call(func() { l.Logger.Debug(description, keysAndValues...) })
+}
+
+func (l *tbLogger) Trace(description string, keysAndValues ...any) {
+	l.t.Helper()
+	l.call(func() { l.Logger.Trace(description, keysAndValues...) })
+}
+
+// SetLevel sets the level of the logger, which strict loggers check errors
+// against.
+func (l *tbLogger) SetLevel(level log.LogLevel) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+	l.Logger.SetLevel(level)
+}
+
+// SetOutput does nothing: the output is the test's log.
+func (l *tbLogger) SetOutput(w io.Writer) {}
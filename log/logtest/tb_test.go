@@ -0,0 +1,135 @@
+package logtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/timehop/golog/log"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("writes each event to the test log", func(t *testing.T) {
+		ft := &fakeT{}
+		logger := New(ft, log.Config{ID: "db", Deterministic: true}, "host", "a")
+		logger.Trace("Connecting.")
+		logger.Info("Connected.", "ms", 3)
+		logger.SetOutput(new(strings.Builder))
+		logger.Warn("Slow.")
+
+		want := []string{"TRACE | db | Connecting. | host='a'", "INFO | db | Connected. | host='a' ms='3'", "WARN | db | Slow. | host='a'"}
+		if strings.Join(ft.logs, "\n") != strings.Join(want, "\n") {
+			t.Errorf("got %q, want %q", ft.logs, want)
+		}
+		if len(ft.failures) != 0 || ft.failedNow {
+			t.Errorf("unexpected failures %v", ft.failures)
+		}
+	})
+
+	t.Run("uses the configured format", func(t *testing.T) {
+		ft := &fakeT{}
+		New(ft, log.Config{Format: log.LogfmtFormat, Deterministic: true}).Error("Failed.")
+
+		if len(ft.logs) != 1 || ft.logs[0] != "ts=2000-01-01T00:00:00.000Z level=error msg=Failed." {
+			t.Errorf("got %q", ft.logs)
+		}
+		if len(ft.failures) != 0 {
+			t.Errorf("unexpected failures %v", ft.failures)
+		}
+	})
+
+	t.Run("stops the test on Fatal", func(t *testing.T) {
+		ft := &fakeT{}
+		logger := New(ft, log.Config{Deterministic: true})
+		logger.Fatal("Gave up.")
+
+		if len(ft.logs) != 1 || ft.logs[0] != "FATAL | Gave up." || !ft.failedNow {
+			t.Errorf("got logs %q and failed now %v", ft.logs, ft.failedNow)
+		}
+
+		ft.failedNow = false
+		logger.SetLevel(log.LogLevel(-1))
+		logger.Fatal("Below the level.")
+		if ft.failedNow {
+			t.Error("expected no failure below the level")
+		}
+	})
+
+	t.Run("fails on errors when strict", func(t *testing.T) {
+		ft := &fakeT{}
+		logger := NewStrict(ft, log.Config{})
+		logger.Warn("Careful.")
+		logger.Error("Failed.")
+
+		if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], "unexpected error logged: Failed.") {
+			t.Errorf("got failures %q", ft.failures)
+		}
+	})
+
+	t.Run("fails on every error when strict, whatever else logs", func(t *testing.T) {
+		ft := &lockedT{}
+		logger := NewStrict(ft, log.Config{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				logger.Info("Busy.")
+			}
+		}()
+		for i := 0; i < 200; i++ {
+			logger.Error("Failed.")
+		}
+		wg.Wait()
+
+		if len(ft.failures) != 200 || len(ft.logs) != 400 {
+			t.Errorf("got %d failures and %d lines, want 200 and 400", len(ft.failures), len(ft.logs))
+		}
+	})
+
+	t.Run("only fails on errors its level lets through", func(t *testing.T) {
+		ft := &fakeT{}
+		logger := NewStrict(ft, log.Config{})
+		logger.SetLevel(log.LevelFatal)
+		logger.Error("Ignored.")
+
+		if len(ft.failures) != 0 || len(ft.logs) != 0 {
+			t.Errorf("got failures %q and logs %q", ft.failures, ft.logs)
+		}
+	})
+
+	t.Run("drops events once the test is done", func(t *testing.T) {
+		ft := &fakeT{}
+		logger := New(ft, log.Config{})
+		for _, cleanup := range ft.cleanups {
+			cleanup()
+		}
+		logger.Info("Late.")
+
+		if len(ft.logs) != 0 {
+			t.Errorf("got %q after the test", ft.logs)
+		}
+	})
+
+	t.Run("logs for real", func(t *testing.T) {
+		New(t, log.Config{}).Info("Attributed to this line.")
+	})
+}
+
+// lockedT is a fakeT for loggers used from several goroutines.
+type lockedT struct {
+	mu sync.Mutex
+	fakeT
+}
+
+func (f *lockedT) Log(args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fakeT.Log(args...)
+}
+
+func (f *lockedT) Errorf(format string, args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fakeT.Errorf(format, args...)
+}
@@ -0,0 +1,285 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Just enough MessagePack for the Fluentd forward protocol: encoding strings,
+// maps, arrays, binary and EventTime, and decoding any value back.
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda)
+		b = appendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = appendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBin(b []byte, data []byte) []byte {
+	switch n := len(data); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5)
+		b = appendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xc6)
+		b = appendUint32(b, uint32(n))
+	}
+	return append(b, data...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xdc)
+		return appendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdd)
+		return appendUint32(b, uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xde)
+		return appendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdf)
+		return appendUint32(b, uint32(n))
+	}
+}
+
+func appendMsgpackUint(b []byte, n uint64) []byte {
+	switch {
+	case n < 128:
+		return append(b, byte(n))
+	case n <= math.MaxUint32:
+		b = append(b, 0xce)
+		return appendUint32(b, uint32(n))
+	default:
+		b = append(b, 0xcf)
+		return appendUint64(b, n)
+	}
+}
+
+// appendMsgpackEventTime appends t as the Fluentd EventTime extension: type 0,
+// holding big endian seconds and nanoseconds.
+func appendMsgpackEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = appendUint32(b, uint32(t.Unix()))
+	return appendUint32(b, uint32(t.Nanosecond()))
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+// msgpackExt is a decoded extension value.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+var errMsgpackShort = errors.New("golog: truncated msgpack value")
+
+// decodeMsgpack decodes the first value in b, returning it and the remaining
+// bytes. Maps decode to map[string]any, arrays to []any, binary to []byte,
+// integers to int64 or uint64, and extensions to msgpackExt.
+func decodeMsgpack(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errMsgpackShort
+	}
+	c, b := b[0], b[1:]
+
+	take := func(n int) ([]byte, error) {
+		if n < 0 || len(b) < n {
+			return nil, errMsgpackShort
+		}
+		v := b[:n]
+		b = b[n:]
+		return v, nil
+	}
+	size := func(width int) (int, error) {
+		v, err := take(width)
+		if err != nil {
+			return 0, err
+		}
+		switch width {
+		case 1:
+			return int(v[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(v)), nil
+		default:
+			return int(binary.BigEndian.Uint32(v)), nil
+		}
+	}
+	str := func(width int) (any, []byte, error) {
+		n, err := size(width)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err := take(n)
+		return string(v), b, err
+	}
+	bin := func(width int) (any, []byte, error) {
+		n, err := size(width)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err := take(n)
+		return append([]byte(nil), v...), b, err
+	}
+	array := func(n int) (any, []byte, error) {
+		values := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			var v any
+			var err error
+			if v, b, err = decodeMsgpack(b); err != nil {
+				return nil, nil, err
+			}
+			values = append(values, v)
+		}
+		return values, b, nil
+	}
+	object := func(n int) (any, []byte, error) {
+		values := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			var k, v any
+			var err error
+			if k, b, err = decodeMsgpack(b); err != nil {
+				return nil, nil, err
+			}
+			if v, b, err = decodeMsgpack(b); err != nil {
+				return nil, nil, err
+			}
+			values[fmt.Sprint(k)] = v
+		}
+		return values, b, nil
+	}
+	ext := func(n int) (any, []byte, error) {
+		v, err := take(n + 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return msgpackExt{Type: int8(v[0]), Data: append([]byte(nil), v[1:]...)}, b, nil
+	}
+	fixed := func(width int) ([]byte, error) {
+		return take(width)
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		v, err := take(int(c & 0x1f))
+		return string(v), b, err
+	case c&0xf0 == 0x90:
+		return array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return object(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xc4:
+		return bin(1)
+	case 0xc5:
+		return bin(2)
+	case 0xc6:
+		return bin(4)
+	case 0xca:
+		v, err := fixed(4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(v))), b, nil
+	case 0xcb:
+		v, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(v)), b, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := fixed(1 << (c - 0xcc))
+		if err != nil {
+			return nil, nil, err
+		}
+		var n uint64
+		for _, x := range v {
+			n = n<<8 | uint64(x)
+		}
+		return n, b, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		width := 1 << (c - 0xd0)
+		v, err := fixed(width)
+		if err != nil {
+			return nil, nil, err
+		}
+		var n uint64
+		for _, x := range v {
+			n = n<<8 | uint64(x)
+		}
+		shift := 64 - 8*width
+		return int64(n<<shift) >> shift, b, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := size(1 << (c - 0xc7))
+		if err != nil {
+			return nil, nil, err
+		}
+		return ext(n)
+	case 0xd9:
+		return str(1)
+	case 0xda:
+		return str(2)
+	case 0xdb:
+		return str(4)
+	case 0xdc, 0xdd:
+		n, err := size(2 << (c - 0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return array(n)
+	case 0xde, 0xdf:
+		n, err := size(2 << (c - 0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return object(n)
+	}
+	return nil, nil, fmt.Errorf("golog: unsupported msgpack type 0x%02x", c)
+}
@@ -0,0 +1,438 @@
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	otlpScopeName     = "github.com/timehop/golog"
+	otlpFlushInterval = time.Second
+	otlpMaxRetries    = 3
+	otlpTimeout       = 10 * time.Second
+	otlpMinBackoff    = 100 * time.Millisecond
+	otlpMaxBackoff    = 5 * time.Second
+	// otlpMaxRetryAfter caps how long a collector may ask to wait before a
+	// retry.
+	otlpMaxRetryAfter = 30 * time.Second
+	otlpBufferLimit   = 8192
+)
+
+// otlpSeverities maps levels to OpenTelemetry severity numbers, each the first
+// of its range.
+var otlpSeverities = map[LogLevelName]int{
+	LevelTraceName: 1,
+	LevelDebugName: 5,
+	LevelInfoName:  9,
+	LevelWarnName:  13,
+	LevelErrorName: 17,
+	LevelFatalName: 21,
+}
+
+// OtlpConfig - OTLP/HTTP log exporter config. Default/unset values for each
+// attribute are safe, except Endpoint.
+type OtlpConfig struct {
+	// Endpoint is the collector's logs URL, e.g.
+	// http://localhost:4318/v1/logs.
+	Endpoint string
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string
+	// Client defaults to an http.Client with a 10s timeout.
+	Client *http.Client
+
+	// BatchSize is the number of records buffered before they're exported.
+	// Defaults to 1: each record is exported as soon as it's logged.
+	BatchSize int
+	// FlushInterval is how often a partial batch is exported. Defaults to 1s.
+	FlushInterval time.Duration
+	// BufferLimit is the most records waiting to be exported, while the
+	// collector is slow or unreachable. Records logged beyond it are dropped.
+	// Defaults to 8192.
+	BufferLimit int
+	// MaxRetries is how many times an export failing with a retryable status,
+	// or a network error, is retried. Defaults to 3.
+	MaxRetries int
+}
+
+// NewOtlpSink returns a sink exporting each event to an OpenTelemetry
+// collector over OTLP/HTTP with JSON encoding, following the OpenTelemetry
+// log data model: the level as SeverityNumber and SeverityText, the
+// description as Body, the logger's static fields as the Resource, and every
+// other key/value as an attribute. trace_id and span_id, static or not, set
+// TraceId and SpanId instead.
+func NewOtlpSink(conf OtlpConfig) (Sink, error) {
+	w, err := NewOtlpWriter(conf)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	return Sink{
+		Output:    w,
+		Level:     defaultLevel,
+		Formatter: FormatterFunc(formatLogEventAsOtlp),
+	}, nil
+}
+
+// otlpEntry is what the OTLP sink's formatter produces: a log record, along
+// with the resource it belongs to.
+type otlpEntry struct {
+	Resource []otlpKeyValue `json:"resource"`
+	Record   otlpLogRecord  `json:"record"`
+}
+
+// otlpLogRecord is a LogRecord in the OTLP/JSON encoding.
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func formatLogEventAsOtlp(e Event) string {
+	now := strconv.FormatInt(e.Time.UnixNano(), 10)
+	entry := otlpEntry{
+		Record: otlpLogRecord{
+			TimeUnixNano:         now,
+			ObservedTimeUnixNano: now,
+			SeverityNumber:       otlpSeverities[e.Level],
+			SeverityText:         string(e.Level),
+			Body:                 otlpAnyValue{e.Message},
+		},
+	}
+
+	// Static fields describe the logger, so they make up the resource, unless
+	// overridden at the call site or read into the record.
+	argKeys := make(map[string]bool, len(e.KeysAndValues)/2)
+	for i := 0; i+1 < len(e.KeysAndValues); i += 2 {
+		argKeys[fmt.Sprintf("%v", e.KeysAndValues[i])] = true
+	}
+
+	for _, f := range e.Fields() {
+		switch {
+		case f.Key == "trace_id" && isHexID(f.Value, 16):
+			entry.Record.TraceID = f.Value
+		case f.Key == "span_id" && isHexID(f.Value, 8):
+			entry.Record.SpanID = f.Value
+		case f.Key == "file":
+			entry.Record.Attributes = append(entry.Record.Attributes, otlpKeyValue{"code.filepath", otlpAnyValue{f.Value}})
+		case f.Key == "line":
+			entry.Record.Attributes = append(entry.Record.Attributes, otlpKeyValue{"code.lineno", otlpAnyValue{f.Value}})
+		case !argKeys[f.Key]:
+			entry.Resource = append(entry.Resource, otlpKeyValue{f.Key, otlpAnyValue{f.Value}})
+		default:
+			entry.Record.Attributes = append(entry.Record.Attributes, otlpKeyValue{f.Key, otlpAnyValue{f.Value}})
+		}
+	}
+
+	// Only strings and ints, which can't fail to marshal.
+	encoded, _ := json.Marshal(entry)
+	return string(encoded)
+}
+
+// isHexID reports whether s is a valid, non-zero, size byte id in hex.
+func isHexID(s string, size int) bool {
+	id, err := hex.DecodeString(s)
+	return err == nil && len(id) == size && !bytes.Equal(id, make([]byte, size))
+}
+
+// OtlpWriter is an io.WriteCloser exporting log records to an OpenTelemetry
+// collector over OTLP/HTTP. Records are buffered and exported in batches,
+// grouped by resource, from a goroutine of its own, so that logging never
+// waits on the collector. Failed exports are retried with exponential
+// backoff.
+type OtlpWriter struct {
+	conf OtlpConfig
+
+	mu      sync.Mutex
+	pending []otlpEntry
+	dropped int
+	// err is the first export error since the last Flush.
+	err    error
+	closed bool
+
+	// ready is signaled when a batch is full, and flushes receive Flush
+	// calls, each waiting for its reply.
+	ready   chan struct{}
+	flushes chan chan error
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewOtlpWriter returns a writer exporting to the collector at conf.Endpoint.
+func NewOtlpWriter(conf OtlpConfig) (*OtlpWriter, error) {
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("golog: unsupported OTLP endpoint %q", conf.Endpoint)
+	}
+	if conf.Client == nil {
+		conf.Client = &http.Client{Timeout: otlpTimeout}
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = otlpFlushInterval
+	}
+	if conf.BufferLimit <= 0 {
+		conf.BufferLimit = otlpBufferLimit
+	}
+	if conf.MaxRetries <= 0 {
+		conf.MaxRetries = otlpMaxRetries
+	}
+
+	w := &OtlpWriter{
+		conf:    conf,
+		ready:   make(chan struct{}, 1),
+		flushes: make(chan chan error),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write buffers p, an entry as produced by the OTLP sink's formatter followed
+// by the logger's newline, to be exported once BatchSize is reached. It
+// doesn't wait for the export: export errors are returned by Flush and Close.
+func (w *OtlpWriter) Write(p []byte) (int, error) {
+	var entry otlpEntry
+	if err := json.Unmarshal(p, &entry); err != nil {
+		return 0, fmt.Errorf("golog: not an OTLP log entry: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	if len(w.pending) >= w.conf.BufferLimit {
+		w.dropped++
+		return len(p), nil
+	}
+	w.pending = append(w.pending, entry)
+	if len(w.pending) >= w.conf.BatchSize {
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Flush exports all buffered records, and returns the first error since the
+// last Flush, including records dropped for a full buffer.
+func (w *OtlpWriter) Flush() error {
+	reply := make(chan error)
+	select {
+	case w.flushes <- reply:
+		return <-reply
+	case <-w.done:
+		return os.ErrClosed
+	}
+}
+
+func (w *OtlpWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.conf.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.ready:
+			w.flush()
+		case reply := <-w.flushes:
+			w.flush()
+			reply <- w.takeErr()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// flush exports the pending records in a single request. They're dropped
+// once the export succeeds, fails for good, or runs out of retries. It's
+// only called from run, or once run is done.
+func (w *OtlpWriter) flush() {
+	w.mu.Lock()
+	entries := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(otlpRequest(entries))
+	if err == nil {
+		err = w.exportWithRetries(body)
+	}
+	if err != nil {
+		w.mu.Lock()
+		if w.err == nil {
+			w.err = err
+		}
+		w.mu.Unlock()
+	}
+}
+
+// exportWithRetries exports body, retrying with backoff until it succeeds,
+// fails for good, runs out of retries, or the writer is closed.
+func (w *OtlpWriter) exportWithRetries(body []byte) error {
+	backoff := otlpMinBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := w.export(body)
+		if err == nil {
+			return nil
+		}
+		var permanent otlpPermanentError
+		if errors.As(err, &permanent) || attempt == w.conf.MaxRetries {
+			return err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-w.stop:
+			return err
+		}
+		if backoff *= 2; backoff > otlpMaxBackoff {
+			backoff = otlpMaxBackoff
+		}
+	}
+}
+
+// takeErr returns and clears the first export error, or reports dropped
+// records.
+func (w *OtlpWriter) takeErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.err
+	if err == nil && w.dropped > 0 {
+		err = fmt.Errorf("golog: OTLP buffer full, dropped %d records", w.dropped)
+	}
+	w.err, w.dropped = nil, 0
+	return err
+}
+
+// otlpRequest groups entries by resource, in order of first appearance, into
+// an ExportLogsServiceRequest.
+func otlpRequest(entries []otlpEntry) map[string]any {
+	type scopeLogs struct {
+		Scope      map[string]string `json:"scope"`
+		LogRecords []otlpLogRecord   `json:"logRecords"`
+	}
+	type resourceLogs struct {
+		Resource  map[string][]otlpKeyValue `json:"resource"`
+		ScopeLogs []*scopeLogs              `json:"scopeLogs"`
+	}
+
+	var all []*resourceLogs
+	byResource := make(map[string]*scopeLogs)
+	for _, entry := range entries {
+		// Can't fail, it's just strings.
+		key, _ := json.Marshal(entry.Resource)
+		scope, ok := byResource[string(key)]
+		if !ok {
+			scope = &scopeLogs{Scope: map[string]string{"name": otlpScopeName}}
+			byResource[string(key)] = scope
+			resource := entry.Resource
+			if resource == nil {
+				resource = []otlpKeyValue{}
+			}
+			all = append(all, &resourceLogs{
+				Resource:  map[string][]otlpKeyValue{"attributes": resource},
+				ScopeLogs: []*scopeLogs{scope},
+			})
+		}
+		scope.LogRecords = append(scope.LogRecords, entry.Record)
+	}
+	return map[string]any{"resourceLogs": all}
+}
+
+// otlpPermanentError is an export rejected in a way retrying won't fix.
+type otlpPermanentError struct {
+	error
+}
+
+// export sends a single request, returning how long the collector asked to
+// wait before retrying, if it did.
+func (w *OtlpWriter) export(body []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, w.conf.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, otlpPermanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.conf.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.conf.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+
+	err = fmt.Errorf("golog: OTLP export failed with %s: %s", resp.Status, bytes.TrimSpace(message))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		retryAfter := time.Duration(seconds) * time.Second
+		if retryAfter > otlpMaxRetryAfter {
+			retryAfter = otlpMaxRetryAfter
+		}
+		return retryAfter, err
+	default:
+		return 0, otlpPermanentError{err}
+	}
+}
+
+// Close exports buffered records, without retrying, and returns the first
+// error since the last Flush.
+func (w *OtlpWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return os.ErrClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	w.flush()
+	return w.takeErr()
+}
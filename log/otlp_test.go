@@ -0,0 +1,340 @@
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type otlpTestRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []otlpLogRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+// otlpCollector is an httptest stand-in for an OpenTelemetry collector's
+// OTLP/HTTP logs endpoint. Each request is answered with the next of
+// statuses, then 200.
+type otlpCollector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []otlpTestRequest
+	headers  []http.Header
+	statuses []int
+}
+
+func newOtlpCollector(t *testing.T, statuses ...int) *otlpCollector {
+	t.Helper()
+	c := &otlpCollector{statuses: statuses}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.handle))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *otlpCollector) handle(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.headers = append(c.headers, r.Header)
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "0")
+		}
+		http.Error(w, "nope", status)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var req otlpTestRequest
+	if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.requests = append(c.requests, req)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func (c *otlpCollector) received() ([]otlpTestRequest, []http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests, c.headers
+}
+
+func attributeMap(attributes []otlpKeyValue) map[string]string {
+	m := make(map[string]string, len(attributes))
+	for _, kv := range attributes {
+		m[kv.Key] = kv.Value.StringValue
+	}
+	return m
+}
+
+func TestOtlpSink(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("exports records following the log data model", func(t *testing.T) {
+		collector := newOtlpCollector(t)
+		sink, err := NewOtlpSink(OtlpConfig{Endpoint: collector.URL + "/v1/logs", Headers: map[string]string{"Api-Key": "secret"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer sink.Output.(io.Closer).Close()
+
+		logger := New(Config{ID: "api", Sinks: []Sink{sink}}, "service.name", "checkout")
+		before := time.Now()
+		logger.Warn("slow request", "trace_id", "4bf92f3577b34da6a3ce929d0e0e4736", "span_id", "00f067aa0ba902b7",
+			"path", "/cart", "file", "main.go", "line", "12")
+		if err := sink.Output.(*OtlpWriter).Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		requests, headers := collector.received()
+		if len(requests) != 1 {
+			t.Fatalf("got %d requests, want 1", len(requests))
+		}
+		if got := headers[0].Get("Api-Key"); got != "secret" {
+			t.Errorf("got Api-Key %q, want secret", got)
+		}
+
+		resourceLogs := requests[0].ResourceLogs[0]
+		wantResource := map[string]string{"golog_id": "api", "service.name": "checkout"}
+		if got := attributeMap(resourceLogs.Resource.Attributes); len(got) != 2 || got["golog_id"] != "api" || got["service.name"] != "checkout" {
+			t.Errorf("got resource %v, want %v", got, wantResource)
+		}
+		if got := resourceLogs.ScopeLogs[0].Scope.Name; got != otlpScopeName {
+			t.Errorf("got scope %q, want %q", got, otlpScopeName)
+		}
+
+		record := resourceLogs.ScopeLogs[0].LogRecords[0]
+		if record.SeverityNumber != 13 || record.SeverityText != "WARN" || record.Body.StringValue != "slow request" {
+			t.Errorf("unexpected record %+v", record)
+		}
+		if record.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || record.SpanID != "00f067aa0ba902b7" {
+			t.Errorf("got trace %q and span %q", record.TraceID, record.SpanID)
+		}
+		wantAttributes := map[string]string{"path": "/cart", "code.filepath": "main.go", "code.lineno": "12"}
+		if got := attributeMap(record.Attributes); len(got) != 3 || got["path"] != "/cart" || got["code.filepath"] != "main.go" || got["code.lineno"] != "12" {
+			t.Errorf("got attributes %v, want %v", got, wantAttributes)
+		}
+		if ns, err := strconv.ParseInt(record.TimeUnixNano, 10, 64); err != nil || time.Unix(0, ns).Before(before) {
+			t.Errorf("unexpected timeUnixNano %q", record.TimeUnixNano)
+		}
+	})
+
+	t.Run("maps every level to a severity", func(t *testing.T) {
+		for level, want := range map[LogLevelName]int{
+			LevelTraceName: 1, LevelDebugName: 5, LevelInfoName: 9,
+			LevelWarnName: 13, LevelErrorName: 17, LevelFatalName: 21,
+		} {
+			var entry otlpEntry
+			json.Unmarshal([]byte(formatLogEventAsOtlp(testEvent(0, level, "msg", nil))), &entry)
+			if entry.Record.SeverityNumber != want {
+				t.Errorf("%s: got %d, want %d", level, entry.Record.SeverityNumber, want)
+			}
+		}
+	})
+
+	t.Run("keeps invalid trace ids as attributes", func(t *testing.T) {
+		var entry otlpEntry
+		json.Unmarshal([]byte(formatLogEventAsOtlp(testEvent(0, LevelInfoName, "msg", nil,
+			"trace_id", "00000000000000000000000000000000", "span_id", "xyz"))), &entry)
+		if entry.Record.TraceID != "" || entry.Record.SpanID != "" || len(entry.Record.Attributes) != 2 {
+			t.Errorf("unexpected record %+v", entry.Record)
+		}
+	})
+
+	t.Run("reads static trace ids into the record", func(t *testing.T) {
+		var entry otlpEntry
+		json.Unmarshal([]byte(formatLogEventAsOtlp(testEvent(0, LevelInfoName, "msg",
+			[]Field{{"service", "api"}, {"trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"}, {"span_id", "00f067aa0ba902b7"}, {"file", "main.go"}}))), &entry)
+		if entry.Record.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || entry.Record.SpanID != "00f067aa0ba902b7" {
+			t.Errorf("unexpected record %+v", entry.Record)
+		}
+		if len(entry.Resource) != 1 || entry.Resource[0].Key != "service" {
+			t.Errorf("got resource %+v, want only service", entry.Resource)
+		}
+		if len(entry.Record.Attributes) != 1 || entry.Record.Attributes[0].Key != "code.filepath" {
+			t.Errorf("got attributes %+v, want the file", entry.Record.Attributes)
+		}
+	})
+
+	t.Run("batches records by resource", func(t *testing.T) {
+		collector := newOtlpCollector(t)
+		sink, err := NewOtlpSink(OtlpConfig{Endpoint: collector.URL + "/v1/logs", BatchSize: 3, FlushInterval: time.Hour})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		first := New(Config{ID: "first", Sinks: []Sink{sink}})
+		second := New(Config{ID: "second", Sinks: []Sink{sink}})
+		first.Info("one")
+		second.Info("two")
+		if requests, _ := collector.received(); len(requests) != 0 {
+			t.Fatalf("got %d requests before the batch filled", len(requests))
+		}
+		first.Info("three")
+		waitFor(t, func() bool {
+			requests, _ := collector.received()
+			return len(requests) == 1
+		})
+
+		requests, _ := collector.received()
+		if len(requests) != 1 || len(requests[0].ResourceLogs) != 2 {
+			t.Fatalf("got %+v, want a single request with two resources", requests)
+		}
+		if got := len(requests[0].ResourceLogs[0].ScopeLogs[0].LogRecords); got != 2 {
+			t.Errorf("got %d records for the first resource, want 2", got)
+		}
+
+		first.Info("four")
+		if err := sink.Output.(io.Closer).Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests, _ := collector.received(); len(requests) != 2 {
+			t.Errorf("got %d requests, want the partial batch exported on close", len(requests))
+		}
+	})
+
+	t.Run("exports partial batches periodically", func(t *testing.T) {
+		collector := newOtlpCollector(t)
+		w, err := NewOtlpWriter(OtlpConfig{Endpoint: collector.URL + "/v1/logs", BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer w.Close()
+
+		New(Config{Sinks: []Sink{{Output: w, Level: LevelInfo, Formatter: FormatterFunc(formatLogEventAsOtlp)}}}).Info("msg")
+		waitFor(t, func() bool {
+			requests, _ := collector.received()
+			return len(requests) == 1
+		})
+	})
+
+	t.Run("retries retryable failures", func(t *testing.T) {
+		collector := newOtlpCollector(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+		w, err := NewOtlpWriter(OtlpConfig{Endpoint: collector.URL + "/v1/logs"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer w.Close()
+
+		if _, err := w.Write([]byte(formatLogEventAsOtlp(testEvent(0, LevelInfoName, "msg", nil)) + "\n")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		requests, headers := collector.received()
+		if len(requests) != 1 || len(headers) != 3 {
+			t.Errorf("got %d exports in %d attempts, want 1 in 3", len(requests), len(headers))
+		}
+	})
+
+	t.Run("gives up on permanent failures and exhausted retries", func(t *testing.T) {
+		collector := newOtlpCollector(t, http.StatusBadRequest, http.StatusBadGateway, http.StatusBadGateway)
+		w, err := NewOtlpWriter(OtlpConfig{Endpoint: collector.URL + "/v1/logs", MaxRetries: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer w.Close()
+
+		entry := []byte(formatLogEventAsOtlp(testEvent(0, LevelInfoName, "msg", nil)) + "\n")
+		w.Write(entry)
+		if err := w.Flush(); err == nil {
+			t.Error("expected an error for a rejected export")
+		}
+		if _, headers := collector.received(); len(headers) != 1 {
+			t.Errorf("got %d attempts, want 1", len(headers))
+		}
+
+		w.Write(entry)
+		if err := w.Flush(); err == nil {
+			t.Error("expected an error once retries run out")
+		}
+		if _, headers := collector.received(); len(headers) != 3 {
+			t.Errorf("got %d attempts, want 3", len(headers))
+		}
+
+		w.Write(entry)
+		if err := w.Flush(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if requests, _ := collector.received(); len(requests) != 1 {
+			t.Errorf("got %d exports, want only the last record", len(requests))
+		}
+	})
+
+	t.Run("doesn't block logging on a slow collector", func(t *testing.T) {
+		release := make(chan struct{})
+		var received sync.WaitGroup
+		received.Add(1)
+		var once sync.Once
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			once.Do(received.Done)
+			<-release
+		}))
+		defer collector.Close()
+
+		w, err := NewOtlpWriter(OtlpConfig{Endpoint: collector.URL + "/v1/logs", BufferLimit: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger := New(Config{Sinks: []Sink{{Output: w, Level: LevelInfo, Formatter: FormatterFunc(formatLogEventAsOtlp)}}})
+
+		logger.Info("exporting")
+		received.Wait()
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			logger.Info("waiting")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("logging took %v while the collector hung", elapsed)
+		}
+
+		close(release)
+		if err := w.Flush(); err == nil || !strings.Contains(err.Error(), "dropped 3 records") {
+			t.Errorf("got %v, want the dropped records reported", err)
+		}
+		w.Close()
+	})
+
+	t.Run("caps Retry-After", func(t *testing.T) {
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}))
+		defer collector.Close()
+
+		w, err := NewOtlpWriter(OtlpConfig{Endpoint: collector.URL})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer w.Close()
+		if retryAfter, err := w.export([]byte("{}")); err == nil || retryAfter != otlpMaxRetryAfter {
+			t.Errorf("got %v, %v, want %v", retryAfter, err, otlpMaxRetryAfter)
+		}
+	})
+
+	t.Run("rejects invalid endpoints", func(t *testing.T) {
+		if _, err := NewOtlpSink(OtlpConfig{Endpoint: "localhost:4318"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
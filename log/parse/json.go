@@ -0,0 +1,137 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/timehop/golog/log"
+)
+
+// parseJson parses a JsonFormat line. Its fields come out golog_id first, then
+// in the order they were written.
+func (conf Config) parseJson(line string) (log.Event, error) {
+	var e log.Event
+	names := conf.jsonNames()
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	if _, err := jsonObject(dec); err != nil {
+		return e, err
+	}
+
+	var ts, level string
+	var fields []log.Field
+	for dec.More() {
+		key, err := jsonKey(dec)
+		if err != nil {
+			return e, err
+		}
+		switch key {
+		case names.Time:
+			err = dec.Decode(&ts)
+		case names.Level:
+			err = dec.Decode(&level)
+		case names.Message:
+			err = dec.Decode(&e.Message)
+		case names.Fields:
+			fields, err = jsonFields(dec)
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err != nil {
+			return e, fmt.Errorf("parse: %w", err)
+		}
+	}
+	if err := jsonEnd(dec); err != nil {
+		return e, err
+	}
+
+	if e.Level = log.LogLevelName(level); !levels[e.Level] {
+		return e, fmt.Errorf("parse: unknown level %q", level)
+	}
+	var ok bool
+	if e.Time, ok = conf.parseTime(ts); !ok {
+		return e, fmt.Errorf("parse: invalid timestamp %q", ts)
+	}
+
+	for _, f := range fields {
+		if f.Key == "golog_id" {
+			e.KeysAndValues = append(e.KeysAndValues, f.Key, f.Value)
+		}
+	}
+	for _, f := range fields {
+		if f.Key != "golog_id" {
+			e.KeysAndValues = append(e.KeysAndValues, f.Key, f.Value)
+		}
+	}
+	return e, nil
+}
+
+// jsonFields decodes the fields object, in order. A key given twice keeps its
+// first place and its last value.
+func jsonFields(dec *json.Decoder) ([]log.Field, error) {
+	if ok, err := jsonObject(dec); !ok {
+		return nil, err
+	}
+
+	var fields []log.Field
+	index := make(map[string]int)
+	for dec.More() {
+		key, err := jsonKey(dec)
+		if err != nil {
+			return nil, err
+		}
+		var value string
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if i, ok := index[key]; ok {
+			fields[i].Value = value
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, log.Field{Key: key, Value: value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// jsonObject reads the start of an object, reporting false for a null.
+func jsonObject(dec *json.Decoder) (bool, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return false, fmt.Errorf("parse: %w", err)
+	}
+	if token == nil {
+		return false, nil
+	}
+	if token != json.Delim('{') {
+		return false, fmt.Errorf("parse: expected an object, got %v", token)
+	}
+	return true, nil
+}
+
+func jsonKey(dec *json.Decoder) (string, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return "", fmt.Errorf("parse: %w", err)
+	}
+	// Within an object, the decoder only hands out string keys.
+	return token.(string), nil
+}
+
+// jsonEnd reads the end of the line's object, which must end the line.
+func jsonEnd(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("parse: unexpected data after the object")
+	}
+	return nil
+}
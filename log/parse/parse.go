@@ -0,0 +1,169 @@
+// Package parse reads golog output back into events: PlainTextFormat lines,
+// stdlib log flags and LOG_PREFIX included, KeyValueFormat lines and
+// JsonFormat lines, detecting the format of each line unless told.
+//
+//	scanner := parse.NewScanner(os.Stdin, parse.Config{})
+//	for scanner.Scan() {
+//		e, err := scanner.Event()
+//		...
+//	}
+//
+// Every field ends up in the event's KeysAndValues, as strings, golog_id
+// first: text lines don't tell static fields from the caller's. The prefix of
+// text lines is kept as a prefix field, as JsonFormat does.
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timehop/golog/log"
+)
+
+// Config - parser config. Default/unset values for each attribute are safe.
+type Config struct {
+	// Format is the format every line is in. DefaultFormat detects it per
+	// line, among PlainTextFormat, KeyValueFormat and JsonFormat.
+	Format log.LogFormat
+	// Prefix is the LOG_PREFIX text lines were written with. Unset, whatever
+	// comes before a text line's timestamp is taken as its prefix.
+	Prefix string
+	// TimeFormat is the Config.TimeFormat lines were written with, if any.
+	TimeFormat string
+	// Location is the time zone of timestamps that don't say, such as the
+	// stdlib log flags'. Defaults to time.Local.
+	Location *time.Location
+	// FieldNames are the Config.FieldNames JsonFormat and KeyValueFormat lines
+	// were written with, if any.
+	FieldNames log.FieldNames
+}
+
+// ErrUnknownFormat is returned for lines in none of the formats.
+var ErrUnknownFormat = errors.New("parse: line isn't in a golog format")
+
+var levels = map[log.LogLevelName]bool{
+	log.LevelFatalName: true,
+	log.LevelErrorName: true,
+	log.LevelWarnName:  true,
+	log.LevelInfoName:  true,
+	log.LevelDebugName: true,
+	log.LevelTraceName: true,
+}
+
+// Line parses a single line, without its trailing newline, detecting its
+// format.
+func Line(line string) (log.Event, log.LogFormat, error) {
+	return Config{}.Line(line)
+}
+
+// Line parses a single line, without its trailing newline, returning the
+// format it was in.
+func (conf Config) Line(line string) (log.Event, log.LogFormat, error) {
+	if conf.Location == nil {
+		conf.Location = time.Local
+	}
+
+	switch conf.Format {
+	case log.PlainTextFormat:
+		e, err := conf.parsePlainText(line)
+		return e, conf.Format, err
+	case log.KeyValueFormat:
+		e, err := conf.parseKeyValue(line)
+		return e, conf.Format, err
+	case log.JsonFormat:
+		e, err := conf.parseJson(line)
+		return e, conf.Format, err
+	case log.DefaultFormat:
+	default:
+		return log.Event{}, "", fmt.Errorf("parse: unsupported format %q", conf.Format)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		if e, err := conf.parseJson(line); err == nil {
+			return e, log.JsonFormat, nil
+		}
+	}
+	if e, err := conf.parseKeyValue(line); err == nil {
+		return e, log.KeyValueFormat, nil
+	}
+	if e, err := conf.parsePlainText(line); err == nil {
+		return e, log.PlainTextFormat, nil
+	}
+	return log.Event{}, "", ErrUnknownFormat
+}
+
+// jsonNames are the keys JsonFormat lines were written with.
+func (conf Config) jsonNames() log.FieldNames {
+	return log.FieldNames{
+		Time:    name(conf.FieldNames.Time, "ts"),
+		Level:   name(conf.FieldNames.Level, "lvl"),
+		Message: name(conf.FieldNames.Message, "msg"),
+		Fields:  name(conf.FieldNames.Fields, "fields"),
+	}
+}
+
+// keyValueNames are the keys KeyValueFormat lines were written with.
+func (conf Config) keyValueNames() log.FieldNames {
+	return log.FieldNames{
+		Time:    name(conf.FieldNames.Time, "timestamp"),
+		Level:   name(conf.FieldNames.Level, "level"),
+		ID:      name(conf.FieldNames.ID, "channel"),
+		Message: name(conf.FieldNames.Message, "message"),
+	}
+}
+
+// name returns the configured name for a key, or the format's own.
+func name(configured, own string) string {
+	if configured != "" {
+		return configured
+	}
+	return own
+}
+
+// parseTime parses a timestamp in the configured time format, or any of
+// those the formats write by default.
+func (conf Config) parseTime(s string) (time.Time, bool) {
+	if conf.TimeFormat != "" {
+		return conf.parseTimeFormat(s, conf.TimeFormat)
+	}
+	for _, format := range []string{time.RFC3339Nano, timeStringLayout, log.TimeFormatEpochSeconds} {
+		if t, ok := conf.parseTimeFormat(s, format); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeStringLayout is time.Time's String layout, which JsonFormat used to
+// write by default.
+const timeStringLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func (conf Config) parseTimeFormat(s, format string) (time.Time, bool) {
+	var unit time.Duration
+	switch format {
+	case log.TimeFormatEpochSeconds:
+		unit = time.Second
+	case log.TimeFormatEpochMillis:
+		unit = time.Millisecond
+	case log.TimeFormatEpochMicros:
+		unit = time.Microsecond
+	case timeStringLayout:
+		// Drop the monotonic clock reading.
+		if i := strings.Index(s, " m="); i >= 0 {
+			s = s[:i]
+		}
+	}
+	if unit != 0 {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, n*int64(unit)).In(conf.Location), true
+	}
+
+	t, err := time.ParseInLocation(format, s, conf.Location)
+	return t, err == nil
+}
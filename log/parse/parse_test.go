@@ -0,0 +1,202 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timehop/golog/log"
+)
+
+// logLine logs a single event through a sink in format, with flags, and
+// returns the line written.
+func logLine(t *testing.T, conf log.Config, format log.LogFormat, flags int) string {
+	t.Helper()
+	output := new(bytes.Buffer)
+	conf.Sinks = []log.Sink{{Output: output, Format: format, Level: log.LevelTrace, Flags: flags}}
+	log.New(conf, "env", "prod").Warn("Slow | query.", "sql", "SELECT 'a'\n", "ms", 250)
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+func keysAndValues(e log.Event) map[string]any {
+	kvs := make(map[string]any)
+	for i := 0; i+1 < len(e.KeysAndValues); i += 2 {
+		kvs[e.KeysAndValues[i].(string)] = e.KeysAndValues[i+1]
+	}
+	return kvs
+}
+
+func TestLine(t *testing.T) {
+	clock := log.FixedClock(time.Date(2009, 1, 23, 1, 23, 23, 123456000, time.UTC))
+
+	for _, test := range []struct {
+		name   string
+		conf   log.Config
+		format log.LogFormat
+		flags  int
+		parse  Config
+		time   time.Time
+	}{
+		{name: "plain text", format: log.PlainTextFormat},
+		{
+			name:   "plain text with stdlib flags",
+			format: log.PlainTextFormat,
+			flags:  log.FlagsDate | log.FlagsPrecisionTime,
+		},
+		{
+			name:   "plain text with a timestamp of its own",
+			conf:   log.Config{Clock: clock, TimeLocation: time.UTC},
+			format: log.PlainTextFormat,
+			flags:  log.FlagsDefault,
+			parse:  Config{Location: time.UTC},
+			time:   time.Date(2009, 1, 23, 1, 23, 23, 0, time.UTC),
+		},
+		{
+			name:   "plain text with a time format",
+			conf:   log.Config{Clock: clock, TimeFormat: time.RFC3339Nano},
+			format: log.PlainTextFormat,
+			flags:  log.FlagsDefault,
+			time:   time.Date(2009, 1, 23, 1, 23, 23, 123456000, time.UTC),
+		},
+		{
+			name:   "key_value",
+			conf:   log.Config{Clock: clock},
+			format: log.KeyValueFormat,
+			time:   time.Date(2009, 1, 23, 1, 23, 23, 0, time.UTC),
+		},
+		{
+			name:   "json",
+			conf:   log.Config{Clock: clock},
+			format: log.JsonFormat,
+			time:   time.Date(2009, 1, 23, 1, 23, 23, 123456000, time.UTC),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.conf.ID = "db"
+			line := logLine(t, test.conf, test.format, test.flags)
+
+			e, format, err := test.parse.Line(line)
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", line, err)
+			}
+			if format != test.format {
+				t.Errorf("%q: got format %q, want %q", line, format, test.format)
+			}
+			if e.Level != log.LevelWarnName || e.Message != "Slow | query." {
+				t.Errorf("%q: got %s %q", line, e.Level, e.Message)
+			}
+			// The stdlib logger's timestamp is the real time.
+			if test.time.IsZero() && test.flags != log.FlagsNone && time.Since(e.Time) > time.Minute {
+				t.Errorf("%q: got time %v, want now", line, e.Time)
+			}
+			if !test.time.IsZero() && !e.Time.Equal(test.time) {
+				t.Errorf("%q: got time %v, want %v", line, e.Time, test.time)
+			}
+			if e.KeysAndValues[0] != "golog_id" || e.KeysAndValues[1] != "db" {
+				t.Errorf("%q: got %v, want golog_id first", line, e.KeysAndValues)
+			}
+			kvs := keysAndValues(e)
+			if kvs["env"] != "prod" || kvs["sql"] != "SELECT 'a'\n" || kvs["ms"] != "250" {
+				t.Errorf("%q: got fields %v", line, kvs)
+			}
+		})
+	}
+}
+
+func TestLineFieldOrder(t *testing.T) {
+	names := log.FieldNames{Time: "@timestamp", Level: "severity", Message: "message", ID: "logger", Fields: "labels"}
+	for _, format := range []log.LogFormat{log.JsonFormat, log.KeyValueFormat} {
+		for _, conf := range []log.Config{{ID: "db"}, {ID: "db", FieldNames: names}} {
+			output := new(bytes.Buffer)
+			conf.Sinks = []log.Sink{{Output: output, Format: format, Level: log.LevelInfo}}
+			log.New(conf, "z", 1).Info("msg", "b", 2, "a", 3)
+			line := strings.TrimSuffix(output.String(), "\n")
+
+			e, _, err := Config{Format: format, FieldNames: conf.FieldNames}.Line(line)
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", line, err)
+			}
+			// Leave out the caller's file and line.
+			if got, want := fmt.Sprint(e.KeysAndValues[:8]), "[golog_id db z 1 b 2 a 3]"; got != want || e.Message != "msg" {
+				t.Errorf("%q: got %s %q, want %s", line, got, e.Message, want)
+			}
+		}
+	}
+}
+
+func TestLinePrefix(t *testing.T) {
+	log.SetPrefix("myapp: ")
+	defer log.SetPrefix("")
+
+	for _, format := range []log.LogFormat{log.PlainTextFormat, log.JsonFormat} {
+		for _, flags := range []int{log.FlagsNone, log.FlagsDefault | log.FlagsShortFile} {
+			line := logLine(t, log.Config{}, format, flags)
+			for _, conf := range []Config{{}, {Prefix: "myapp: "}} {
+				e, _, err := conf.Line(line)
+				if err != nil {
+					t.Fatalf("%q: unexpected error: %v", line, err)
+				}
+				if got := keysAndValues(e)["prefix"]; got != "myapp: " {
+					t.Errorf("%q: got prefix %q", line, got)
+				}
+				if format == log.PlainTextFormat && e.Flags != flags {
+					t.Errorf("%q: got flags %d, want %d", line, e.Flags, flags)
+				}
+			}
+		}
+	}
+}
+
+func TestLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"Listening on :8080",
+		"INFORMATION: starting",
+		`{"ts": "2009-01-23", "lvl": "LOUD", "msg": "Hi."}`,
+	} {
+		if _, _, err := Line(line); err != ErrUnknownFormat {
+			t.Errorf("%q: got %v, want ErrUnknownFormat", line, err)
+		}
+	}
+
+	for _, test := range []struct {
+		format log.LogFormat
+		line   string
+	}{
+		{log.PlainTextFormat, "INFO | api | Hello. | k='v"},
+		{log.PlainTextFormat, `INFO | Hello \q.`},
+		{log.KeyValueFormat, "INFO | Hello."},
+		{log.JsonFormat, "{"},
+		{"xml", "<INFO/>"},
+	} {
+		if _, _, err := (Config{Format: test.format}).Line(test.line); err == nil {
+			t.Errorf("%s %q: expected an error", test.format, test.line)
+		}
+	}
+}
+
+func TestPlainTextSegments(t *testing.T) {
+	for line, want := range map[string][]string{
+		"INFO":                            {"", ""},
+		"INFO | Hello.":                   {"", "Hello."},
+		"INFO  | Hello.":                  {"", "Hello."},
+		"INFO | api | Hello.":             {"api", "Hello."},
+		"INFO | Hello. | k='v'":           {"", "Hello."},
+		"INFO | api | Hello. | k='v'":     {"api", "Hello."},
+		"INFO | Hello. | ='v'":            {"", "Hello."},
+		`INFO | a\|b | c \x00é | k='v'`:   {"a|b", "c \x00é"},
+		"ERROR | Saw INFO | in the logs.": {"Saw INFO", "in the logs."},
+	} {
+		e, err := Config{}.parsePlainText(line)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", line, err)
+			continue
+		}
+		id, _ := keysAndValues(e)["golog_id"].(string)
+		if id != want[0] || e.Message != want[1] {
+			t.Errorf("%q: got %q %q, want %q", line, id, e.Message, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package parse
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/timehop/golog/log"
+)
+
+// maxLineSize is the longest line a Scanner reads.
+const maxLineSize = 1 << 20
+
+// Scanner reads events from lines of golog output, such as a log file or
+// the output of a service piped in.
+//
+//	scanner := parse.NewScanner(r, parse.Config{})
+//	for scanner.Scan() {
+//		e, err := scanner.Event()
+//		if err != nil {
+//			// Not a golog line: scanner.Text() has it as is.
+//		}
+//	}
+//	if err := scanner.Err(); err != nil {
+//		...
+//	}
+type Scanner struct {
+	conf    Config
+	lines   *bufio.Scanner
+	event   log.Event
+	format  log.LogFormat
+	lineErr error
+}
+
+// NewScanner returns a scanner reading lines from r, parsed with conf.
+func NewScanner(r io.Reader, conf Config) *Scanner {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &Scanner{conf: conf, lines: lines}
+}
+
+// Scan advances to the next line, returning false at the end of the input or
+// on a read error. A line that doesn't parse doesn't stop the scan.
+func (s *Scanner) Scan() bool {
+	if !s.lines.Scan() {
+		return false
+	}
+	s.event, s.format, s.lineErr = s.conf.Line(s.lines.Text())
+	if s.lineErr != nil {
+		s.format = ""
+	}
+	return true
+}
+
+// Text returns the current line, as read.
+func (s *Scanner) Text() string {
+	return s.lines.Text()
+}
+
+// Event returns the current line's event, or why it couldn't be parsed.
+func (s *Scanner) Event() (log.Event, error) {
+	return s.event, s.lineErr
+}
+
+// Format returns the format the current line was in, or "" if it couldn't be
+// parsed.
+func (s *Scanner) Format() log.LogFormat {
+	return s.format
+}
+
+// Err returns the first read error, if any.
+func (s *Scanner) Err() error {
+	return s.lines.Err()
+}
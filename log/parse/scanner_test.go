@@ -0,0 +1,38 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/timehop/golog/log"
+)
+
+func TestScanner(t *testing.T) {
+	output := new(bytes.Buffer)
+	log.New(log.Config{Sinks: []log.Sink{
+		{Output: output, Format: log.PlainTextFormat, Level: log.LevelInfo},
+		{Output: output, Format: log.JsonFormat, Level: log.LevelInfo},
+	}}).Info("Started.", "port", 8080)
+	output.WriteString("panic: something went wrong\n")
+	log.New(log.Config{Sinks: []log.Sink{{Output: output, Format: log.KeyValueFormat, Level: log.LevelInfo}}}).Error("Stopped.")
+
+	scanner := NewScanner(output, Config{})
+	var got []string
+	for scanner.Scan() {
+		e, err := scanner.Event()
+		if err != nil {
+			got = append(got, "? "+scanner.Text())
+			continue
+		}
+		got = append(got, string(scanner.Format())+" "+e.Message)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"text Started.", "json Started.", "? panic: something went wrong", "key_value Stopped."}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
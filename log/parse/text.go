@@ -0,0 +1,208 @@
+package parse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/timehop/golog/log"
+	"github.com/timehop/golog/log/internal/textformat"
+)
+
+// textLevel matches the level segment of a text line, padded or not.
+var textLevel = regexp.MustCompile(`(FATAL|ERROR|WARN|INFO|DEBUG|TRACE) *(?: \| |$)`)
+
+// stdlibHeader matches what the stdlib logger writes before a text line for
+// its flags: the date, the time, with or without microseconds, and the file.
+var stdlibHeader = regexp.MustCompile(`(?:(\d{4}/\d{2}/\d{2}) )?(?:(\d{2}:\d{2}:\d{2}(?:\.\d{6})?) )?(?:(\S+):\d+: )?$`)
+
+// parsePlainText parses a PlainTextFormat line:
+//
+//	[prefix] [timestamp " | "] level " | " [id " | "] description [" | " pairs]
+func (conf Config) parsePlainText(line string) (log.Event, error) {
+	var e log.Event
+
+	// Segments other than pairs escape pipes, so the first level followed by
+	// a separator is the level segment.
+	m := textLevel.FindStringSubmatchIndex(line)
+	if m == nil {
+		return e, fmt.Errorf("parse: no level in %q", line)
+	}
+	at := m[0]
+	e.Level = log.LogLevelName(line[m[2]:m[3]])
+
+	var prefix string
+	if head := line[:at]; strings.HasSuffix(head, " | ") {
+		prefix = conf.parseTextHeader(&e, strings.TrimSuffix(head, " | "))
+	} else {
+		prefix = head
+	}
+
+	var id, pairs string
+	rest := line[m[1]:]
+	switch segments := strings.SplitN(rest, " | ", 3); {
+	case len(segments) == 3 && isTextPairs(segments[2]):
+		id, e.Message, pairs = segments[0], segments[1], segments[2]
+	case len(segments) >= 2 && isTextPairs(strings.Join(segments[1:], " | ")):
+		e.Message, pairs = segments[0], strings.Join(segments[1:], " | ")
+	case len(segments) == 2:
+		id, e.Message = segments[0], segments[1]
+	case len(segments) == 1:
+		e.Message = segments[0]
+	default:
+		return e, fmt.Errorf("parse: unexpected segments in %q", line)
+	}
+
+	var err error
+	if e.Message, err = unescapeText(e.Message); err != nil {
+		return e, err
+	}
+	if id != "" {
+		if id, err = unescapeText(id); err != nil {
+			return e, err
+		}
+		e.KeysAndValues = append(e.KeysAndValues, "golog_id", id)
+	}
+	if prefix != "" {
+		e.KeysAndValues = append(e.KeysAndValues, "prefix", prefix)
+	}
+	fields, err := parseTextPairs(pairs)
+	if err != nil {
+		return e, err
+	}
+	for _, f := range fields {
+		e.KeysAndValues = append(e.KeysAndValues, f.Key, f.Value)
+	}
+	return e, nil
+}
+
+// parseTextHeader parses the prefix and timestamp before a text line's level,
+// setting the event's time and flags, and returns the prefix.
+func (conf Config) parseTextHeader(e *log.Event, head string) string {
+	var prefix string
+	if conf.Prefix != "" && strings.HasPrefix(head, conf.Prefix) {
+		prefix, head = conf.Prefix, strings.TrimPrefix(head, conf.Prefix)
+	}
+
+	// A time format is written as a segment of its own, with as many spaces
+	// as it has.
+	if conf.TimeFormat != "" {
+		tokens := strings.Split(head, " ")
+		if n := strings.Count(conf.TimeFormat, " ") + 1; n <= len(tokens) {
+			if t, ok := conf.parseTime(strings.Join(tokens[len(tokens)-n:], " ")); ok {
+				e.Time = t
+				return prefix + strings.Join(tokens[:len(tokens)-n], " ")
+			}
+		}
+		return prefix + head
+	}
+
+	// The stdlib logger ends its header with a space, the text formats don't.
+	head = strings.TrimSuffix(head, " ") + " "
+	if m := stdlibHeader.FindStringSubmatchIndex(head); m[1]-m[0] > 1 {
+		date, clock := "", ""
+		if m[2] >= 0 {
+			date = head[m[2]:m[3]]
+			e.Flags |= log.FlagsDate
+		}
+		if m[4] >= 0 {
+			clock = head[m[4]:m[5]]
+			e.Flags |= log.FlagsTime
+			if strings.Contains(clock, ".") {
+				e.Flags |= log.FlagsPrecisionTime
+			}
+		}
+		if m[6] >= 0 {
+			if strings.Contains(head[m[6]:m[7]], "/") {
+				e.Flags |= log.FlagsLongFile
+			} else {
+				e.Flags |= log.FlagsShortFile
+			}
+		}
+		if date == "" {
+			date = "0000/01/01"
+		}
+		if clock == "" {
+			clock = "00:00:00"
+		}
+		if e.Flags&(log.FlagsDate|log.FlagsTime) != 0 {
+			e.Time, _ = time.ParseInLocation("2006/01/02 15:04:05.999999", date+" "+clock, conf.Location)
+		}
+		return prefix + head[:m[0]]
+	}
+
+	// A time format the sink was given, which isn't the config's: try the
+	// defaults on the last token.
+	head = strings.TrimSuffix(head, " ")
+	i := strings.LastIndex(head, " ") + 1
+	if t, ok := conf.parseTime(head[i:]); ok {
+		e.Time = t
+		return prefix + head[:i]
+	}
+	return prefix + head
+}
+
+// isTextPairs reports whether s is a valid, non-empty pairs segment.
+func isTextPairs(s string) bool {
+	fields, err := parseTextPairs(s)
+	return err == nil && len(fields) > 0
+}
+
+// parseKeyValue parses a KeyValueFormat line:
+//
+//	timestamp='…' level='…' channel='…' message='…' [pairs]
+func (conf Config) parseKeyValue(line string) (log.Event, error) {
+	var e log.Event
+	fields, err := parseTextPairs(strings.TrimLeft(line, " "))
+	if err != nil {
+		return e, err
+	}
+	names := conf.keyValueNames()
+	if len(fields) < 4 || fields[0].Key != names.Time || fields[1].Key != names.Level ||
+		fields[2].Key != names.ID || fields[3].Key != names.Message {
+		return e, fmt.Errorf("parse: not a key_value line: %q", line)
+	}
+
+	var ok bool
+	if e.Time, ok = conf.parseTime(fields[0].Value); !ok {
+		if e.Time, ok = conf.parseTimeFormat(fields[0].Value, log.TimeFormatEpochSeconds); !ok {
+			return e, fmt.Errorf("parse: invalid timestamp %q", fields[0].Value)
+		}
+	}
+	if e.Level = log.LogLevelName(fields[1].Value); !levels[e.Level] {
+		return e, fmt.Errorf("parse: unknown level %q", fields[1].Value)
+	}
+	// Lines without an id have the channel Golog.
+	if id := fields[2].Value; id != "Golog" {
+		e.KeysAndValues = append(e.KeysAndValues, "golog_id", id)
+	}
+	e.Message = fields[3].Value
+	for _, f := range fields[4:] {
+		e.KeysAndValues = append(e.KeysAndValues, f.Key, f.Value)
+	}
+	return e, nil
+}
+
+// parseTextPairs parses k='v' pairs, unescaping values.
+func parseTextPairs(s string) ([]log.Field, error) {
+	pairs, err := textformat.ParsePairs(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	fields := make([]log.Field, len(pairs))
+	for i, p := range pairs {
+		fields[i] = log.Field{Key: p.Key, Value: p.Value}
+	}
+	return fields, nil
+}
+
+// unescapeText reverses the escaping of the text formats, described in the
+// log package doc.
+func unescapeText(s string) (string, error) {
+	unescaped, err := textformat.Unescape(s)
+	if err != nil {
+		return "", fmt.Errorf("parse: %w", err)
+	}
+	return unescaped, nil
+}
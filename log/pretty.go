@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	prettyFieldIndent = "    "
+	prettyBlockIndent = "        "
+)
+
+// formatLogEventAsPretty formats an event over several lines, for reading
+// large fields during development: a PlainTextFormat header, then each
+// key/value on its own indented line.
+//
+//	ERROR | db | Query failed.
+//	    error: timed out
+//	    query:
+//	        SELECT *
+//	        FROM users
+//	    params:
+//	        {
+//	          "id": 42
+//	        }
+//
+// Multi-line values are indented as blocks, and maps, structs and strings
+// holding a JSON object or array are pretty-printed as JSON.
+func (o formatOptions) formatLogEventAsPretty(e Event) string {
+	// Call-site values are rendered raw, so that maps and structs can be
+	// indented, in the order Fields puts them in.
+	raw := make(map[string][]any, len(e.KeysAndValues)/2)
+	for i := 0; i+1 < len(e.KeysAndValues); i += 2 {
+		key := fmt.Sprintf("%v", e.KeysAndValues[i])
+		raw[key] = append(raw[key], e.KeysAndValues[i+1])
+	}
+
+	var id any
+	var fields []any
+	for _, f := range e.Fields() {
+		var value any = f.Value
+		if values := raw[f.Key]; len(values) > 0 {
+			value, raw[f.Key] = values[0], values[1:]
+		}
+		if f.Key == "golog_id" && id == nil {
+			id = value
+		} else {
+			fields = append(fields, f.Key, value)
+		}
+	}
+
+	header := Event{Time: e.Time, Level: e.Level, Message: e.Message, Flags: e.Flags}
+	if id != nil {
+		header.KeysAndValues = []any{"golog_id", id}
+	}
+
+	var b strings.Builder
+	b.WriteString(o.formatLogEventAsPlainText(header))
+	for i := 0; i+1 < len(fields); i += 2 {
+		b.WriteString("\n" + prettyFieldIndent + escapeTextKey(fields[i].(string)) + ":")
+
+		value := prettyValue(fields[i+1])
+		if !strings.Contains(value, "\n") {
+			if value != "" {
+				b.WriteString(" " + escapePrettyLine(value))
+			}
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+			b.WriteString("\n" + prettyBlockIndent + escapePrettyLine(strings.TrimSuffix(line, "\r")))
+		}
+	}
+	return b.String()
+}
+
+// prettyValue renders maps, structs and JSON strings as indented JSON, and
+// anything else as %v does.
+func prettyValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+			var indented bytes.Buffer
+			// Can't fail on valid JSON.
+			json.Indent(&indented, []byte(trimmed), "", "  ")
+			return indented.String()
+		}
+		return v
+	case error, fmt.Stringer:
+		return fmt.Sprintf("%v", v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Map || rv.Kind() == reflect.Struct {
+		if encoded, err := json.MarshalIndent(v, "", "  "); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// escapePrettyLine keeps a line of a value from breaking out of its block, or
+// taking control of the terminal. Tabs are expanded, for stack traces.
+func escapePrettyLine(s string) string {
+	return escapeText(strings.ReplaceAll(s, "\t", "    "), "")
+}
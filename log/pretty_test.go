@@ -0,0 +1,92 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrettyFormat(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("prints a header and a line per field", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPretty(testEvent(0, LevelErrorName, "Query failed.", []Field{{"golog_id", "db"}, {"host", "a"}},
+			"error", errors.New("timed out"), "empty", ""))
+		want := "ERROR | db | Query failed.\n" +
+			"    host: a\n" +
+			"    error: timed out\n" +
+			"    empty:"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("indents multi-line values as blocks", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPretty(testEvent(0, LevelInfoName, "msg", nil,
+			"query", "SELECT *\r\nFROM users\n", "stack", "main.main()\n\tmain.go:12"))
+		want := "INFO | msg\n" +
+			"    query:\n" +
+			"        SELECT *\n" +
+			"        FROM users\n" +
+			"    stack:\n" +
+			"        main.main()\n" +
+			"            main.go:12"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("pretty-prints JSON", func(t *testing.T) {
+		type user struct {
+			Name string `json:"name"`
+		}
+		got := formatOptions{}.formatLogEventAsPretty(testEvent(0, LevelInfoName, "msg", nil,
+			"user", &user{"bilbo"}, "tags", map[string]int{"a": 1}, "payload", ` {"ok":true} `,
+			"at", time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC), "list", []int{1, 2}))
+		want := "INFO | msg\n" +
+			"    user:\n" +
+			"        {\n" +
+			"          \"name\": \"bilbo\"\n" +
+			"        }\n" +
+			"    tags:\n" +
+			"        {\n" +
+			"          \"a\": 1\n" +
+			"        }\n" +
+			"    payload:\n" +
+			"        {\n" +
+			"          \"ok\": true\n" +
+			"        }\n" +
+			"    at: 2014-06-01 00:00:00 +0000 UTC\n" +
+			"    list: [1 2]"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("keeps values from faking lines", func(t *testing.T) {
+		got := formatOptions{}.formatLogEventAsPretty(testEvent(0, LevelInfoName, "a\nb", nil, "k", "x\nERROR | fake\x1b[2J"))
+		want := "INFO | a\\nb\n" +
+			"    k:\n" +
+			"        x\n" +
+			"        ERROR | fake"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("writes through a logger with prefix and flags", func(t *testing.T) {
+		t.Setenv("LOG_PREFIX", "app ")
+		initLogging()
+		output := new(bytes.Buffer)
+		sink := NewSink(output, PrettyFormat)
+		sink.Flags = FlagsDate
+
+		New(Config{ID: "id", Sinks: []Sink{sink}}).Info("msg", "k", "v")
+
+		want := "app " + time.Now().Format("2006/01/02") + "  | INFO | id | msg\n    k: v\n"
+		if got := output.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
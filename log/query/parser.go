@@ -0,0 +1,207 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEnd {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lexer splits a query into tokens.
+type lexer struct {
+	text string
+	pos  int
+}
+
+// ops are the comparison operators, longest first so that >= isn't read as >.
+var ops = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.text) && unicode.IsSpace(rune(l.text[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.text) {
+		return token{kind: tokenEnd, pos: start}, nil
+	}
+
+	switch c := l.text[l.pos]; c {
+	case '(':
+		l.pos++
+		return token{kind: tokenOpen, text: "(", pos: start}, nil
+	case ')':
+		l.pos++
+		return token{kind: tokenClose, text: ")", pos: start}, nil
+	case '"':
+		// Find the closing quote, skipping escaped ones.
+		end := l.pos + 1
+		for ; end < len(l.text) && l.text[end] != '"'; end++ {
+			if l.text[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(l.text) {
+			return token{}, fmt.Errorf("query: unterminated string at column %d", start+1)
+		}
+		text, err := strconv.Unquote(l.text[start : end+1])
+		if err != nil {
+			return token{}, fmt.Errorf("query: invalid string at column %d", start+1)
+		}
+		l.pos = end + 1
+		return token{kind: tokenString, text: text, pos: start}, nil
+	}
+
+	for _, op := range ops {
+		if strings.HasPrefix(l.text[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokenOp, text: op, pos: start}, nil
+		}
+	}
+
+	for l.pos < len(l.text) && !isDelimiter(l.text[l.pos]) {
+		l.pos++
+	}
+	return token{kind: tokenWord, text: l.text[start:l.pos], pos: start}, nil
+}
+
+// isDelimiter reports whether c ends a bare word.
+func isDelimiter(c byte) bool {
+	return unicode.IsSpace(rune(c)) || strings.IndexByte(`()"!=<>~`, c) >= 0
+}
+
+// parser is a recursive descent parser over the lexer's tokens:
+//
+//	or         = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" or ")" | comparison
+//	comparison = word op ( word | string )
+type parser struct {
+	lexer
+	tok token
+}
+
+func (p *parser) next() error {
+	tok, err := p.lexer.next()
+	p.tok = tok
+	return err
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("query: %s at column %d", fmt.Sprintf(format, args...), p.tok.pos+1)
+}
+
+// keyword reports whether the current token is the keyword, in any case.
+func (p *parser) keyword(keyword string) bool {
+	return p.tok.kind == tokenWord && strings.EqualFold(p.tok.text, keyword)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch {
+	case p.keyword("not"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	case p.tok.kind == tokenOpen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenClose {
+			return nil, p.errorf("expected \")\", got %s", p.tok)
+		}
+		return n, p.next()
+	case p.tok.kind == tokenWord:
+		return p.parseComparison()
+	}
+	return nil, p.errorf("expected a comparison, got %s", p.tok)
+}
+
+func (p *parser) parseComparison() (node, error) {
+	name := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenOp {
+		return nil, p.errorf("expected an operator after %q, got %s", name, p.tok)
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenWord && p.tok.kind != tokenString {
+		return nil, p.errorf("expected a value after %q, got %s", name+op, p.tok)
+	}
+	c, err := newComparison(name, op, p.tok.text)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return c, p.next()
+}
@@ -0,0 +1,235 @@
+// Package query filters events with a small query language:
+//
+//	level>=WARN and id=db and (latency_ms>200 or msg~"timeout")
+//
+// A query is comparisons joined with and, or and not, grouped with
+// parentheses. Each compares a name to a value, bare or double-quoted, with
+// one of = != < <= > >= and ~ !~, which match a regular expression. Names are:
+//
+//	level    the event's level, ordered by severity: level>=WARN matches WARN,
+//	         ERROR and FATAL
+//	msg      the event's description; message works too
+//	id       the golog_id field
+//	anything else, the field of that name
+//
+// Values that are both numbers compare as numbers, others as strings. A
+// comparison with a field the event doesn't have only matches for != and !~.
+// Keywords and level names are case insensitive.
+//
+// Queries work on events from a logger as well as those read back with the
+// parse package, and filter sinks through Sink.Where:
+//
+//	q, err := query.Parse("level>=WARN or id=billing")
+//	...
+//	sink := log.NewSink(os.Stdout, log.JsonFormat)
+//	sink.Where = q.Match
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/timehop/golog/log"
+)
+
+// Query is a parsed query, safe for concurrent use.
+type Query struct {
+	text string
+	root node
+}
+
+// Parse parses a query. The empty query matches every event.
+func Parse(text string) (*Query, error) {
+	p := &parser{lexer: lexer{text: text}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenEnd {
+		return &Query{text: text}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEnd {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Query{text: text, root: root}, nil
+}
+
+// MustParse is Parse, but panics on an invalid query, for queries known when
+// the program is written.
+func MustParse(text string) *Query {
+	q, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Match reports whether e matches the query.
+func (q *Query) Match(e log.Event) bool {
+	if q.root == nil {
+		return true
+	}
+	return q.root.match(e, e.Fields())
+}
+
+// String returns the query as parsed.
+func (q *Query) String() string {
+	return q.text
+}
+
+// node is a part of a parsed query. fields are e.Fields(), which are only
+// merged once per event.
+type node interface {
+	match(e log.Event, fields []log.Field) bool
+}
+
+type and struct{ left, right node }
+
+func (n and) match(e log.Event, fields []log.Field) bool {
+	return n.left.match(e, fields) && n.right.match(e, fields)
+}
+
+type or struct{ left, right node }
+
+func (n or) match(e log.Event, fields []log.Field) bool {
+	return n.left.match(e, fields) || n.right.match(e, fields)
+}
+
+type not struct{ node }
+
+func (n not) match(e log.Event, fields []log.Field) bool {
+	return !n.node.match(e, fields)
+}
+
+// comparison compares what name is in an event to value.
+type comparison struct {
+	name  string
+	op    string
+	value string
+	// number is value as a number, if it's one.
+	number   float64
+	isNumber bool
+	// pattern is value compiled, for ~ and !~.
+	pattern *regexp.Regexp
+}
+
+// levelSeverities orders levels by severity, most severe highest.
+var levelSeverities = map[log.LogLevelName]float64{
+	log.LevelFatalName: 5,
+	log.LevelErrorName: 4,
+	log.LevelWarnName:  3,
+	log.LevelInfoName:  2,
+	log.LevelDebugName: 1,
+	log.LevelTraceName: 0,
+}
+
+func newComparison(name, op, value string) (*comparison, error) {
+	c := &comparison{name: name, op: op, value: value}
+	switch name {
+	case "message":
+		c.name = "msg"
+	case "golog_id":
+		c.name = "id"
+	}
+
+	switch {
+	case op == "~" || op == "!~":
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", value, err)
+		}
+		c.pattern = pattern
+	case c.name == "level":
+		severity, ok := levelSeverities[log.LogLevelName(strings.ToUpper(value))]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", value)
+		}
+		c.number, c.isNumber = severity, true
+	default:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			c.number, c.isNumber = n, true
+		}
+	}
+	return c, nil
+}
+
+func (c *comparison) match(e log.Event, fields []log.Field) bool {
+	var value string
+	found := true
+	switch c.name {
+	case "level":
+		if c.pattern == nil {
+			severity, ok := levelSeverities[e.Level]
+			return ok && compare(c.op, compareNumbers(severity, c.number))
+		}
+		value = string(e.Level)
+	case "msg":
+		value = e.Message
+	default:
+		key := c.name
+		if key == "id" {
+			key = "golog_id"
+		}
+		value, found = lookup(fields, key)
+	}
+
+	switch {
+	case !found:
+		return c.op == "!=" || c.op == "!~"
+	case c.op == "~":
+		return c.pattern.MatchString(value)
+	case c.op == "!~":
+		return !c.pattern.MatchString(value)
+	case c.isNumber:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return compare(c.op, compareNumbers(n, c.number))
+		}
+	}
+	return compare(c.op, strings.Compare(value, c.value))
+}
+
+// lookup returns the value of the field named key.
+func lookup(fields []log.Field, key string) (string, bool) {
+	for _, f := range fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// compare applies op to the result of comparing two values: negative, zero
+// or positive, as strings.Compare returns.
+func compare(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package query
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/timehop/golog/log"
+)
+
+func event(level log.LogLevelName, message string, keysAndValues ...any) log.Event {
+	return log.Event{Level: level, Message: message, KeysAndValues: keysAndValues}
+}
+
+func TestMatch(t *testing.T) {
+	slow := event(log.LevelWarnName, "Query timeout.", "golog_id", "db", "latency_ms", "250", "table", "users")
+	fast := event(log.LevelInfoName, "Query done.", "golog_id", "db", "latency_ms", 12)
+	other := event(log.LevelErrorName, "Request failed.", "golog_id", "api", "status", "502")
+
+	for query, want := range map[string][]bool{
+		"":                                  {true, true, true},
+		"level>=WARN":                       {true, false, true},
+		"level>=warn and id=db":             {true, false, false},
+		"LEVEL<info":                        {false, false, false},
+		"level=INFO or level=error":         {false, true, true},
+		`level~"^(WARN|INFO)$"`:             {true, true, false},
+		"latency_ms>200":                    {true, false, false},
+		"latency_ms<100":                    {false, true, false},
+		"latency_ms>=12 and latency_ms<=12": {false, true, false},
+		`msg~"timeout"`:                     {true, false, false},
+		`message!~"^Query"`:                 {false, false, true},
+		`msg="Query done."`:                 {false, true, false},
+		"table=users":                       {true, false, false},
+		"table!=users":                      {false, true, true},
+		"table>=a":                          {true, false, false},
+		"status>=500 or latency_ms>200":     {true, false, true},
+		"not id=db":                         {false, false, true},
+		"NOT (id=db AND level=INFO)":        {true, false, true},
+		"id=db and (latency_ms>200 or level>=ERROR)": {true, false, false},
+		"id=db or id=api and level=WARN":             {true, true, false},
+	} {
+		q, err := Parse(query)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", query, err)
+			continue
+		}
+		for i, e := range []log.Event{slow, fast, other} {
+			if got := q.Match(e); got != want[i] {
+				t.Errorf("%q: got %v for %q, want %v", query, got, e.Message, want[i])
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for query, want := range map[string]string{
+		"level":              `expected an operator after "level", got end of query at column 6`,
+		"level>=":            `expected a value after "level>=", got end of query at column 8`,
+		"level>=LOUD":        `unknown level "LOUD" at column 8`,
+		"id=db and":          "expected a comparison, got end of query at column 10",
+		"(id=db":             `expected ")", got end of query at column 7`,
+		"id=db)":             `unexpected ")" at column 6`,
+		`msg~"("`:            "invalid pattern",
+		`msg="timeout`:       "unterminated string at column 5",
+		"id=db latency_ms>1": `unexpected "latency_ms" at column 7`,
+	} {
+		if _, err := Parse(query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want %q", query, err, want)
+		}
+	}
+}
+
+func TestSinkWhere(t *testing.T) {
+	output := new(bytes.Buffer)
+	sink := log.NewSink(output, log.PlainTextFormat)
+	sink.Flags = log.FlagsNone
+	sink.Where = MustParse("level>=WARN or user=1").Match
+
+	logger := log.New(log.Config{ID: "api", Sinks: []log.Sink{sink}})
+	logger.Warn("Slow.", "user", 2)
+	logger.Info("Hello.", "user", 1)
+	logger.Info("Hello.", "user", 2)
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "WARN | api | Slow. | user='2'") || !strings.HasPrefix(lines[1], "INFO | api | Hello. | user='1'") {
+		t.Errorf("got %q, want the warning and user 1's info", lines)
+	}
+}
@@ -0,0 +1,176 @@
+package log
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reopenInterval is how often ReopenOnChange checks the path by default.
+const reopenInterval = time.Second
+
+// ReopenableFile is an io.WriteCloser appending to a file that can be reopened
+// by path, for use with an external rotator such as logrotate: once the file
+// has been renamed away, Reopen starts writing to a fresh file at the
+// original path.
+//
+// Writes and reopens are serialized, so each log line ends up whole in either
+// the old or the new file.
+type ReopenableFile struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// OpenReopenableFile opens path for appending, creating it if needed.
+func OpenReopenableFile(path string) (*ReopenableFile, error) {
+	file, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReopenableFile{
+		path: path,
+		file: file,
+		stop: make(chan struct{}),
+	}, nil
+}
+
+func openAppend(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// Write appends p to the currently open file.
+func (f *ReopenableFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	return f.file.Write(p)
+}
+
+// Reopen closes the current file and opens the path again. If the path can't
+// be opened, the old file stays in use and the error is returned.
+func (f *ReopenableFile) Reopen() error {
+	// Open before taking the lock, so that writers aren't blocked on the
+	// filesystem.
+	file, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	old := f.file
+	if old == nil {
+		f.mu.Unlock()
+		file.Close()
+		return os.ErrClosed
+	}
+	f.file = file
+	f.mu.Unlock()
+
+	return old.Close()
+}
+
+// ReopenOnSignal reopens the file every time the process receives one of sigs,
+// SIGHUP if none are given, until Close is called. Reopen errors are
+// reported to onError, which may be nil.
+func (f *ReopenableFile) ReopenOnSignal(onError func(error), sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				f.reportError(onError, f.Reopen())
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+// ReopenOnChange checks the path every interval, and reopens the file once the
+// path is missing or refers to a different file (inode) than the one being
+// written to, until Close is called. If interval <= 0, the path is checked
+// every second. Reopen errors are reported to onError, which may be nil.
+func (f *ReopenableFile) ReopenOnChange(interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = reopenInterval
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if f.changed() {
+					f.reportError(onError, f.Reopen())
+				}
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+// changed reports whether the path no longer refers to the open file.
+func (f *ReopenableFile) changed() bool {
+	f.mu.Lock()
+	file := f.file
+	f.mu.Unlock()
+	if file == nil {
+		return false
+	}
+
+	current, err := file.Stat()
+	if err != nil {
+		return true
+	}
+	onDisk, err := os.Stat(f.path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(current, onDisk)
+}
+
+func (f *ReopenableFile) reportError(onError func(error), err error) {
+	if err != nil && onError != nil {
+		onError(err)
+	}
+}
+
+// Close stops any automatic reopening and closes the file.
+func (f *ReopenableFile) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,203 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func fileContains(path, s string) bool {
+	b, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(b), s)
+}
+
+func TestReopenableFile(t *testing.T) {
+	t.Run("reopens the path after it was renamed", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		f, err := OpenReopenableFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+
+		f.Write([]byte("before\n"))
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.Write([]byte("still old\n"))
+		if err := f.Reopen(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.Write([]byte("after\n"))
+
+		if b, _ := os.ReadFile(path + ".1"); string(b) != "before\nstill old\n" {
+			t.Errorf("got %q", b)
+		}
+		if b, _ := os.ReadFile(path); string(b) != "after\n" {
+			t.Errorf("got %q", b)
+		}
+	})
+
+	t.Run("keeps the old file when the path can't be opened", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "sub", "app.log")
+		os.Mkdir(filepath.Dir(path), 0o755)
+		f, err := OpenReopenableFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+
+		os.Rename(filepath.Dir(path), filepath.Join(dir, "moved"))
+		if err := f.Reopen(); err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, err := f.Write([]byte("x\n")); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("loses no lines when reopening during concurrent logging", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		f, err := OpenReopenableFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+
+		resetLogging(t)
+		logger := New(Config{ID: "id"})
+		logger.SetOutput(f)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 250; i++ {
+					logger.Info(fmt.Sprintf("line %d-%d", g, i))
+				}
+			}(g)
+		}
+		for i := 1; i <= 5; i++ {
+			os.Rename(path, fmt.Sprintf("%s.%d", path, i))
+			if err := f.Reopen(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		wg.Wait()
+
+		matches, _ := filepath.Glob(path + "*")
+		var lines []string
+		for _, match := range matches {
+			b, _ := os.ReadFile(match)
+			lines = append(lines, strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")...)
+		}
+		count := 0
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			if !strings.HasPrefix(line, "INFO | id | line ") {
+				t.Fatalf("corrupt line %q", line)
+			}
+			count++
+		}
+		if count != 1000 {
+			t.Errorf("got %d lines, want 1000", count)
+		}
+	})
+
+	t.Run("reopens on SIGHUP", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("signals can't be sent to self on windows")
+		}
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		f, err := OpenReopenableFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+		f.ReopenOnSignal(func(err error) { t.Errorf("unexpected error: %v", err) })
+
+		os.Rename(path, path+".1")
+		p, _ := os.FindProcess(os.Getpid())
+		if err := p.Signal(syscall.SIGHUP); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		waitFor(t, func() bool {
+			f.Write([]byte("after\n"))
+			return fileContains(path, "after")
+		})
+	})
+
+	t.Run("reopens when the inode changes", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		f, err := OpenReopenableFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer f.Close()
+		f.ReopenOnChange(time.Millisecond, func(err error) { t.Errorf("unexpected error: %v", err) })
+
+		os.Rename(path, path+".1")
+		os.WriteFile(path, nil, 0o644)
+
+		waitFor(t, func() bool {
+			f.Write([]byte("after\n"))
+			return fileContains(path, "after")
+		})
+	})
+
+	t.Run("defaults a non-positive interval", func(t *testing.T) {
+		f, err := OpenReopenableFile(filepath.Join(t.TempDir(), "app.log"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.ReopenOnChange(0, nil)
+		f.ReopenOnChange(-time.Second, nil)
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails writes after Close", func(t *testing.T) {
+		f, err := OpenReopenableFile(filepath.Join(t.TempDir(), "app.log"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.ReopenOnChange(time.Millisecond, nil)
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := f.Write([]byte("x\n")); err == nil {
+			t.Error("expected an error")
+		}
+		if err := f.Reopen(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,292 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ringBufferSize = 1000
+	// ringBufferFollowers is how many events a follower may fall behind by
+	// before it misses some.
+	ringBufferFollowers = 256
+)
+
+// RingBuffer keeps the last events logged to its sink in memory, and serves
+// them over HTTP, for debugging a live service without access to wherever
+// its logs end up.
+type RingBuffer struct {
+	mu        sync.Mutex
+	events    []Event
+	next      int
+	full      bool
+	followers map[chan Event]struct{}
+}
+
+// NewRingBuffer returns a ring buffer keeping the last size events, or the
+// last 1000 if size <= 0.
+func NewRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		size = ringBufferSize
+	}
+	return &RingBuffer{
+		events:    make([]Event, size),
+		followers: make(map[chan Event]struct{}),
+	}
+}
+
+// Sink returns a sink keeping events up to level in b, whatever the level of
+// the logger's other sinks, e.g. to keep the last debug events of a service
+// that writes info events to stdout.
+func (b *RingBuffer) Sink(level LogLevel) Sink {
+	return Sink{
+		Output: io.Discard,
+		Level:  level,
+		Formatter: FormatterFunc(func(e Event) string {
+			b.add(e)
+			return ""
+		}),
+	}
+}
+
+func (b *RingBuffer) add(e Event) {
+	// Values are rendered now, since they may have changed by the time the
+	// event is served.
+	keysAndValues := make([]any, len(e.KeysAndValues))
+	for i, v := range e.KeysAndValues {
+		keysAndValues[i] = fmt.Sprintf("%v", v)
+	}
+	e.KeysAndValues, e.Flags = keysAndValues, FlagsNone
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.events[b.next] = e
+	if b.next++; b.next == len(b.events) {
+		b.next, b.full = 0, true
+	}
+	for follower := range b.followers {
+		select {
+		case follower <- e:
+		default:
+		}
+	}
+}
+
+// Events returns the events kept, oldest first.
+func (b *RingBuffer) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.kept()
+}
+
+func (b *RingBuffer) kept() []Event {
+	if !b.full {
+		return append([]Event(nil), b.events[:b.next]...)
+	}
+	return append(append([]Event(nil), b.events[b.next:]...), b.events[:b.next]...)
+}
+
+// follow returns the events kept, and a channel receiving those added later,
+// until unfollow is called.
+func (b *RingBuffer) follow() ([]Event, chan Event) {
+	follower := make(chan Event, ringBufferFollowers)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.followers[follower] = struct{}{}
+	return b.kept(), follower
+}
+
+func (b *RingBuffer) unfollow(follower chan Event) {
+	b.mu.Lock()
+	delete(b.followers, follower)
+	b.mu.Unlock()
+}
+
+// ringBufferQuery is what a request to a RingBuffer asks for.
+type ringBufferQuery struct {
+	level  LogLevel
+	id     string
+	fields []Field
+	limit  int
+	format LogFormat
+	follow bool
+}
+
+func parseRingBufferQuery(r *http.Request) (ringBufferQuery, error) {
+	params := r.URL.Query()
+	q := ringBufferQuery{
+		level:  LevelTrace,
+		id:     params.Get("id"),
+		format: PlainTextFormat,
+		follow: params.Get("follow") != "" || r.Header.Get("Accept") == "text/event-stream",
+	}
+
+	if name := params.Get("level"); name != "" {
+		level, ok := levelByName(LogLevelName(strings.ToUpper(name)))
+		if !ok {
+			return q, fmt.Errorf("unknown level %q", name)
+		}
+		q.level = level
+	}
+	for _, field := range params["field"] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return q, fmt.Errorf("field %q isn't key=value", field)
+		}
+		q.fields = append(q.fields, Field{key, value})
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %q", limit)
+		}
+		q.limit = n
+	}
+	switch format := LogFormat(params.Get("format")); format {
+	case "", PlainTextFormat:
+	case JsonFormat:
+		q.format = format
+	default:
+		return q, fmt.Errorf("unsupported format %q", format)
+	}
+	return q, nil
+}
+
+func levelByName(name LogLevelName) (LogLevel, bool) {
+	for level, n := range levelNames {
+		if n == name {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// matches reports whether e is at least as severe as the query's level, and
+// has its id and fields.
+func (q ringBufferQuery) matches(e Event) bool {
+	if level, _ := levelByName(e.Level); level > q.level {
+		return false
+	}
+
+	fields := e.Fields()
+	if q.id != "" {
+		if id, _ := popField(fields, "golog_id"); id != q.id {
+			return false
+		}
+	}
+	for _, want := range q.fields {
+		found := false
+		for _, f := range fields {
+			if f == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// render renders e as a single line, with an RFC 3339 timestamp.
+func (q ringBufferQuery) render(e Event) string {
+	opts := formatOptions{timeFormat: TimeFormatRFC3339Nano}
+	if q.format == JsonFormat {
+		return opts.formatLogEventAsJson(e)
+	}
+	return opts.formatLogEventAsPlainText(e)
+}
+
+// ServeHTTP serves the events kept, oldest first, one per line, as plain text
+// or, with format=json, JSON. These parameters narrow them down:
+//
+//	level=WARN        events at least as severe as WARN
+//	id=db             events with golog_id db
+//	field=user=42     events with a field user of 42; repeat for several fields
+//	limit=100         the last 100 matching events
+//
+// With follow=1, or an Accept header of text/event-stream, events logged
+// later are streamed too, as Server-Sent Events, until the client goes away.
+// Followers falling too far behind miss events.
+func (b *RingBuffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q, err := parseRingBufferQuery(r)
+	if err != nil {
+		http.Error(w, "golog: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var events []Event
+	var follower chan Event
+	if q.follow {
+		events, follower = b.follow()
+		defer b.unfollow(follower)
+	} else {
+		events = b.Events()
+	}
+
+	var matched []Event
+	for _, e := range events {
+		if q.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	if q.limit > 0 && len(matched) > q.limit {
+		matched = matched[len(matched)-q.limit:]
+	}
+
+	if !q.follow {
+		if q.format == JsonFormat {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		for _, e := range matched {
+			io.WriteString(w, q.render(e)+"\n")
+		}
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "golog: streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, e := range matched {
+		writeServerSentEvent(w, q.render(e))
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case e := <-follower:
+			if q.matches(e) {
+				writeServerSentEvent(w, q.render(e))
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeServerSentEvent writes data as a single event, with a data line per
+// line of data.
+func writeServerSentEvent(w io.Writer, data string) {
+	var b strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	io.WriteString(w, b.String())
+}
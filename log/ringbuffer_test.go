@@ -0,0 +1,162 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("keeps the last events at its own level", func(t *testing.T) {
+		output := new(bytes.Buffer)
+		buffer := NewRingBuffer(3)
+		logger := New(Config{Sinks: []Sink{{Output: output, Level: LevelInfo}, buffer.Sink(LevelDebug)}})
+		for _, description := range []string{"one", "two", "three", "four"} {
+			logger.Debug(description)
+		}
+		logger.Trace("five")
+
+		events := buffer.Events()
+		if len(events) != 3 || events[0].Message != "two" || events[2].Message != "four" {
+			t.Errorf("got %+v, want the last 3 debug events", events)
+		}
+		if output.String() != "" {
+			t.Errorf("got %q on the info sink", output.String())
+		}
+	})
+
+	t.Run("snapshots values", func(t *testing.T) {
+		buffer := NewRingBuffer(0)
+		values := map[string]int{"a": 1}
+		New(Config{Sinks: []Sink{buffer.Sink(LevelInfo)}}).Info("msg", "values", values)
+		values["a"] = 2
+
+		if got := buffer.Events()[0].Fields(); len(got) != 1 || got[0].Value != "map[a:1]" {
+			t.Errorf("got %v, want the value when logged", got)
+		}
+	})
+
+	buffer := NewRingBuffer(10)
+	logger := New(Config{ID: "api", Sinks: []Sink{buffer.Sink(LevelTrace)}}, "env", "prod")
+	logger.Debug("Cache miss.", "user", 1)
+	logger.Warn("Slow query.", "user", 2, "golog_id", "db")
+	logger.Error("Query failed.", "user", 1, "golog_id", "db")
+
+	get := func(t *testing.T, query string) (int, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		buffer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logs?"+query, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("serves filtered events as text", func(t *testing.T) {
+		for query, want := range map[string][]string{
+			"":                       {"DEBUG | api | Cache miss.", "WARN | db | Slow query.", "ERROR | db | Query failed."},
+			"level=warn":             {"WARN | db | Slow query.", "ERROR | db | Query failed."},
+			"id=api":                 {"DEBUG | api | Cache miss."},
+			"field=user=1":           {"DEBUG | api | Cache miss.", "ERROR | db | Query failed."},
+			"field=user=1&id=db":     {"ERROR | db | Query failed."},
+			"field=env=prod&limit=1": {"ERROR | db | Query failed."},
+			"field=env=dev":          nil,
+		} {
+			code, body := get(t, query)
+			lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+			if body == "" {
+				lines = nil
+			}
+			if code != http.StatusOK || len(lines) != len(want) {
+				t.Errorf("%q: got %d %q, want %q", query, code, body, want)
+				continue
+			}
+			for i, line := range lines {
+				// Lines start with an RFC 3339 timestamp.
+				if ts, rest, _ := strings.Cut(line, " | "); !strings.HasPrefix(rest, want[i]) {
+					t.Errorf("%q: got %q, want %q", query, line, want[i])
+				} else if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+					t.Errorf("%q: unexpected timestamp in %q", query, line)
+				}
+			}
+		}
+	})
+
+	t.Run("serves events as json", func(t *testing.T) {
+		code, body := get(t, "format=json&level=ERROR")
+		var entry struct {
+			Level  LogLevelName      `json:"lvl"`
+			Fields map[string]string `json:"fields"`
+		}
+		if err := json.Unmarshal([]byte(body), &entry); code != http.StatusOK || err != nil {
+			t.Fatalf("got %d %q: %v", code, body, err)
+		}
+		if entry.Level != LevelErrorName || entry.Fields["golog_id"] != "db" || entry.Fields["user"] != "1" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+	})
+
+	t.Run("rejects invalid queries", func(t *testing.T) {
+		for _, query := range []string{"level=LOUD", "field=user", "limit=-1", "format=xml"} {
+			if code, _ := get(t, query); code != http.StatusBadRequest {
+				t.Errorf("%q: got %d, want 400", query, code)
+			}
+		}
+	})
+
+	t.Run("streams events as they're logged", func(t *testing.T) {
+		server := httptest.NewServer(buffer)
+		defer server.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"?id=db&limit=1", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Errorf("got content type %q", got)
+		}
+
+		events := make(chan string, 16)
+		go func() {
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+					events <- data
+				}
+			}
+			close(events)
+		}()
+		next := func() string {
+			select {
+			case data := <-events:
+				return data
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for an event")
+				return ""
+			}
+		}
+
+		if got := next(); !strings.Contains(got, "| ERROR | db | Query failed.") {
+			t.Errorf("got %q, want the last kept event", got)
+		}
+		logger.Info("Not db.")
+		logger.Info("Reconnected.", "golog_id", "db")
+		if got := next(); !strings.Contains(got, "| INFO | db | Reconnected.") {
+			t.Errorf("got %q, want the new event", got)
+		}
+
+		resp.Body.Close()
+		waitFor(t, func() bool {
+			buffer.mu.Lock()
+			defer buffer.mu.Unlock()
+			return len(buffer.followers) == 0
+		})
+	})
+}
@@ -0,0 +1,383 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeLayout is embedded in rotated file names. It sorts lexically in
+// chronological order and contains no path separators.
+const rotateTimeLayout = "2006-01-02T15-04-05.000"
+
+// RotateConfig - RotatingFile config. Zero values disable the corresponding
+// rotation or cleanup rule.
+type RotateConfig struct {
+	// Filename is the stable name of the log, e.g. /var/log/app.log. Files are
+	// written next to it with a timestamp inserted before the extension, e.g.
+	// /var/log/app-2014-06-01T15-04-05.000.log.
+	Filename string
+	// MaxSize rotates the file before a write would grow it past this many
+	// bytes.
+	MaxSize int64
+	// Interval rotates the file whenever the wall clock crosses a multiple of
+	// the interval, e.g. at midnight UTC for 24h.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
+	// MaxAge removes rotated files older than this.
+	MaxAge time.Duration
+	// Compress gzips rotated files in the background.
+	Compress bool
+	// Symlink keeps a symlink at Filename pointing to the current file. A
+	// regular file already at Filename is rotated first, as a backup.
+	Symlink bool
+}
+
+// rotateConfigFromEnv builds the config for the LOG_FILE output from the
+// LOG_FILE_* env variables. Unparseable values are ignored. The symlink is on
+// unless LOG_FILE_SYMLINK turns it off, so that LOG_FILE names a path to tail.
+func rotateConfigFromEnv(filename string) RotateConfig {
+	conf := RotateConfig{Filename: filename, Symlink: true}
+
+	if size, err := strconv.ParseInt(os.Getenv("LOG_FILE_MAX_SIZE"), 10, 64); err == nil {
+		conf.MaxSize = size
+	}
+	if interval, err := time.ParseDuration(os.Getenv("LOG_FILE_INTERVAL")); err == nil {
+		conf.Interval = interval
+	}
+	if backups, err := strconv.Atoi(os.Getenv("LOG_FILE_MAX_BACKUPS")); err == nil {
+		conf.MaxBackups = backups
+	}
+	if age, err := time.ParseDuration(os.Getenv("LOG_FILE_MAX_AGE")); err == nil {
+		conf.MaxAge = age
+	}
+	if compress, err := strconv.ParseBool(os.Getenv("LOG_FILE_COMPRESS")); err == nil {
+		conf.Compress = compress
+	}
+	if symlink, err := strconv.ParseBool(os.Getenv("LOG_FILE_SYMLINK")); err == nil {
+		conf.Symlink = symlink
+	}
+
+	return conf
+}
+
+// RotatingFile is an io.WriteCloser writing to a file that is rotated by size
+// and/or time. It's safe for concurrent use, and can be handed to SetOutput or
+// used as a Sink's output.
+type RotatingFile struct {
+	conf RotateConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	name     string
+	size     int64
+	rotateAt time.Time
+
+	millMu  sync.Mutex
+	millWg  sync.WaitGroup
+	millErr error
+}
+
+// NewRotatingFile opens a new file for conf.Filename, creating its directory if
+// needed.
+func NewRotatingFile(conf RotateConfig) (*RotatingFile, error) {
+	if conf.Filename == "" {
+		return nil, errors.New("golog: RotateConfig.Filename is required")
+	}
+
+	f := &RotatingFile{conf: conf, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(conf.Filename), 0o755); err != nil {
+		return nil, err
+	}
+	if err := f.openNew(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes p to the current file, rotating first if p would push it past
+// MaxSize or the rotation interval has elapsed. A single write larger than
+// MaxSize is written whole to a fresh file.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	sizeExceeded := f.conf.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.conf.MaxSize
+	intervalElapsed := !f.rotateAt.IsZero() && !f.now().Before(f.rotateAt)
+	if sizeExceeded || intervalElapsed {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file and opens a new one, regardless of size or
+// time.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Name returns the path of the file currently written to.
+func (f *RotatingFile) Name() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.name
+}
+
+// Close closes the current file and waits for background compression and
+// cleanup to finish, returning the first error they hit.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.millWg.Wait()
+	if err == nil {
+		f.millMu.Lock()
+		err = f.millErr
+		f.millMu.Unlock()
+	}
+	return err
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := f.openNew(); err != nil {
+		return err
+	}
+
+	f.millWg.Add(1)
+	go f.mill()
+	return nil
+}
+
+func (f *RotatingFile) openNew() error {
+	now := f.now()
+	name := f.freeBackupName(now)
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	f.name = name
+	f.size = 0
+	if f.conf.Interval > 0 {
+		f.rotateAt = now.Truncate(f.conf.Interval).Add(f.conf.Interval)
+	}
+
+	if f.conf.Symlink {
+		// Create the link under a temporary name and rename it over the old one,
+		// so that readers never see the link missing.
+		if err := f.keepPlainFile(); err != nil {
+			return err
+		}
+		tmp := f.conf.Filename + ".tmp-symlink"
+		os.Remove(tmp)
+		if err := os.Symlink(filepath.Base(name), tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, f.conf.Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freeBackupName returns the name of a file rotated at t that isn't taken.
+// Two rotations within the same millisecond would share a name, so it falls
+// back to a counter rather than appending to the previous file.
+func (f *RotatingFile) freeBackupName(t time.Time) string {
+	name := f.backupName(t)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = f.backupName(t) + "." + fmt.Sprint(i)
+	}
+}
+
+// keepPlainFile rotates a regular file at Filename, such as one written
+// before Symlink was set, as a backup of when it was last written, so that
+// the symlink doesn't replace it. Anything else but a symlink there is an
+// error.
+func (f *RotatingFile) keepPlainFile() error {
+	info, err := os.Lstat(f.conf.Filename)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case info.Mode()&os.ModeSymlink != 0:
+		return nil
+	case !info.Mode().IsRegular():
+		return fmt.Errorf("golog: %s isn't a file or a symlink", f.conf.Filename)
+	}
+	return os.Rename(f.conf.Filename, f.freeBackupName(info.ModTime()))
+}
+
+func (f *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	return filepath.Join(dir, prefix+t.In(time.Local).Format(rotateTimeLayout)+ext)
+}
+
+func (f *RotatingFile) nameParts() (dir, prefix, ext string) {
+	base := filepath.Base(f.conf.Filename)
+	ext = filepath.Ext(base)
+	return filepath.Dir(f.conf.Filename), strings.TrimSuffix(base, ext) + "-", ext
+}
+
+type rotatedFile struct {
+	path      string
+	timestamp time.Time
+}
+
+// backups lists the rotated files, newest first, excluding current.
+func (f *RotatingFile) backups(current string) ([]rotatedFile, error) {
+	dir, prefix, ext := f.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if !entry.Type().IsRegular() || path == current || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(name, prefix)
+		if len(stamp) < len(rotateTimeLayout) {
+			continue
+		}
+		timestamp, err := time.ParseInLocation(rotateTimeLayout, stamp[:len(rotateTimeLayout)], time.Local)
+		if err != nil {
+			continue
+		}
+		rest := strings.TrimSuffix(stamp[len(rotateTimeLayout):], ".gz")
+		if !strings.HasPrefix(rest, ext) {
+			continue
+		}
+
+		files = append(files, rotatedFile{path: path, timestamp: timestamp})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].timestamp.Equal(files[j].timestamp) {
+			return files[i].path > files[j].path
+		}
+		return files[i].timestamp.After(files[j].timestamp)
+	})
+	return files, nil
+}
+
+// mill compresses and removes rotated files according to the config. Runs in
+// the background, one at a time.
+func (f *RotatingFile) mill() {
+	defer f.millWg.Done()
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+
+	setErr := func(err error) {
+		if err != nil && f.millErr == nil {
+			f.millErr = err
+		}
+	}
+
+	// List under the write lock so that a concurrent rotation can't slip a new
+	// current file into the list.
+	f.mu.Lock()
+	files, err := f.backups(f.name)
+	f.mu.Unlock()
+	if err != nil {
+		setErr(err)
+		return
+	}
+
+	var keep []rotatedFile
+	cutoff := f.now().Add(-f.conf.MaxAge)
+	for i, file := range files {
+		expired := f.conf.MaxAge > 0 && file.timestamp.Before(cutoff)
+		excess := f.conf.MaxBackups > 0 && i >= f.conf.MaxBackups
+		if expired || excess {
+			setErr(os.Remove(file.path))
+			continue
+		}
+		keep = append(keep, file)
+	}
+
+	if !f.conf.Compress {
+		return
+	}
+	for _, file := range keep {
+		if !strings.HasSuffix(file.path, ".gz") {
+			setErr(compressFile(file.path))
+		}
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
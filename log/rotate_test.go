@@ -0,0 +1,299 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestRotatingFile(t *testing.T, conf RotateConfig) (*RotatingFile, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2014, 6, 1, 12, 0, 0, 0, time.Local)}
+
+	f := &RotatingFile{conf: conf, now: clock.Now}
+	if err := f.openNew(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f, clock
+}
+
+func readDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Run("requires a filename", func(t *testing.T) {
+		if _, err := NewRotatingFile(RotateConfig{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("writes to a timestamped file", func(t *testing.T) {
+		dir := t.TempDir()
+		f, _ := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log")})
+
+		if _, err := f.Write([]byte("hello\n")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := filepath.Join(dir, "app-2014-06-01T12-00-00.000.log")
+		if f.Name() != want {
+			t.Errorf("got %q, want %q", f.Name(), want)
+		}
+		if b, _ := os.ReadFile(want); string(b) != "hello\n" {
+			t.Errorf("got %q, want %q", b, "hello\n")
+		}
+	})
+
+	t.Run("rotates by size", func(t *testing.T) {
+		dir := t.TempDir()
+		f, clock := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log"), MaxSize: 10})
+
+		f.Write([]byte("12345\n"))
+		clock.now = clock.now.Add(time.Second)
+		f.Write([]byte("12345\n"))
+
+		if got := readDir(t, dir); len(got) != 2 {
+			t.Fatalf("got files %v, want 2", got)
+		}
+		if b, _ := os.ReadFile(f.Name()); string(b) != "12345\n" {
+			t.Errorf("got %q, want %q", b, "12345\n")
+		}
+	})
+
+	t.Run("writes oversized lines whole", func(t *testing.T) {
+		dir := t.TempDir()
+		f, _ := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log"), MaxSize: 4})
+
+		line := "longer than max size\n"
+		if n, err := f.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("got %d, %v", n, err)
+		}
+		if got := readDir(t, dir); len(got) != 1 {
+			t.Errorf("got files %v, want 1", got)
+		}
+	})
+
+	t.Run("does not reuse a name within the same millisecond", func(t *testing.T) {
+		dir := t.TempDir()
+		f, _ := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log")})
+		first := f.Name()
+
+		if err := f.Rotate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if f.Name() != first+".1" {
+			t.Errorf("got %q, want %q", f.Name(), first+".1")
+		}
+	})
+
+	t.Run("rotates by interval", func(t *testing.T) {
+		dir := t.TempDir()
+		f, clock := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log"), Interval: time.Hour})
+
+		f.Write([]byte("a\n"))
+		clock.now = clock.now.Add(59 * time.Minute)
+		f.Write([]byte("b\n"))
+		if got := readDir(t, dir); len(got) != 1 {
+			t.Fatalf("got files %v, want 1", got)
+		}
+
+		clock.now = clock.now.Add(time.Minute)
+		f.Write([]byte("c\n"))
+		if got := readDir(t, dir); len(got) != 2 {
+			t.Fatalf("got files %v, want 2", got)
+		}
+	})
+
+	t.Run("keeps MaxBackups rotated files", func(t *testing.T) {
+		dir := t.TempDir()
+		f, clock := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log"), MaxBackups: 2})
+
+		for i := 0; i < 4; i++ {
+			clock.now = clock.now.Add(time.Second)
+			if err := f.Rotate(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		f.millWg.Wait()
+
+		got := readDir(t, dir)
+		want := []string{
+			"app-2014-06-01T12-00-02.000.log",
+			"app-2014-06-01T12-00-03.000.log",
+			"app-2014-06-01T12-00-04.000.log",
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("removes files older than MaxAge", func(t *testing.T) {
+		dir := t.TempDir()
+		f, clock := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log"), MaxAge: time.Hour})
+
+		clock.now = clock.now.Add(30 * time.Minute)
+		f.Rotate()
+		clock.now = clock.now.Add(45 * time.Minute)
+		f.Rotate()
+		f.millWg.Wait()
+
+		got := readDir(t, dir)
+		want := []string{
+			"app-2014-06-01T12-30-00.000.log",
+			"app-2014-06-01T13-15-00.000.log",
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("compresses rotated files", func(t *testing.T) {
+		dir := t.TempDir()
+		f, clock := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(dir, "app.log"), Compress: true})
+
+		f.Write([]byte("compress me\n"))
+		clock.now = clock.now.Add(time.Second)
+		f.Rotate()
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		gzFile, err := os.Open(filepath.Join(dir, "app-2014-06-01T12-00-00.000.log.gz"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer gzFile.Close()
+		r, err := gzip.NewReader(gzFile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if b, _ := io.ReadAll(r); string(b) != "compress me\n" {
+			t.Errorf("got %q, want %q", b, "compress me\n")
+		}
+		if got := readDir(t, dir); len(got) != 2 {
+			t.Errorf("got files %v, want the .gz and the current file", got)
+		}
+	})
+
+	t.Run("points a symlink at the current file", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		f, clock := newTestRotatingFile(t, RotateConfig{Filename: filename, Symlink: true})
+
+		clock.now = clock.now.Add(time.Second)
+		f.Rotate()
+		f.Write([]byte("current\n"))
+
+		target, err := os.Readlink(filename)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if target != filepath.Base(f.Name()) {
+			t.Errorf("got %q, want %q", target, filepath.Base(f.Name()))
+		}
+		if b, _ := os.ReadFile(filename); string(b) != "current\n" {
+			t.Errorf("got %q, want %q", b, "current\n")
+		}
+	})
+
+	t.Run("keeps a plain file where the symlink goes", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		if err := os.WriteFile(filename, []byte("before symlinks\n"), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f, _ := newTestRotatingFile(t, RotateConfig{Filename: filename, Symlink: true})
+
+		if target, err := os.Readlink(filename); err != nil || target != filepath.Base(f.Name()) {
+			t.Errorf("got %q, %v, want a symlink to %q", target, err, filepath.Base(f.Name()))
+		}
+		backups, err := f.backups(f.Name())
+		if err != nil || len(backups) != 1 {
+			t.Fatalf("got backups %v, %v, want the plain file", backups, err)
+		}
+		if b, _ := os.ReadFile(backups[0].path); string(b) != "before symlinks\n" {
+			t.Errorf("got %q, want the plain file's content", b)
+		}
+	})
+
+	t.Run("refuses to replace a directory with the symlink", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		if err := os.Mkdir(filename, 0o755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f := &RotatingFile{conf: RotateConfig{Filename: filename, Symlink: true}, now: time.Now}
+		defer f.Close()
+		if err := f.openNew(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("fails writes after Close", func(t *testing.T) {
+		f, _ := newTestRotatingFile(t, RotateConfig{Filename: filepath.Join(t.TempDir(), "app.log")})
+		f.Close()
+
+		if _, err := f.Write([]byte("x\n")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestLogFileEnv(t *testing.T) {
+	resetLogging(t)
+	dir := t.TempDir()
+	t.Setenv("LOG_FILE", filepath.Join(dir, "app.log"))
+	t.Setenv("LOG_FILE_SYMLINK", "")
+	t.Setenv("LOG_FILE_MAX_SIZE", "1024")
+	initLogging()
+	t.Cleanup(func() {
+		t.Setenv("LOG_FILE", "")
+		initLogging()
+	})
+
+	if envFile == nil || envFile.conf.MaxSize != 1024 {
+		t.Fatalf("LOG_FILE_MAX_SIZE not applied: %+v", envFile)
+	}
+
+	Error("id", "msg")
+
+	b, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != "ERROR | id | msg\n" {
+		t.Errorf("got %q, want %q", b, "ERROR | id | msg\n")
+	}
+	if info, err := os.Lstat(filepath.Join(dir, "app.log")); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("LOG_FILE is not a symlink: %v, %v", info, err)
+	}
+
+	t.Run("links the file unless told not to", func(t *testing.T) {
+		for value, want := range map[string]bool{"": true, "nope": true, "false": false} {
+			t.Setenv("LOG_FILE_SYMLINK", value)
+			if got := rotateConfigFromEnv("app.log").Symlink; got != want {
+				t.Errorf("LOG_FILE_SYMLINK=%q: got %v, want %v", value, got, want)
+			}
+		}
+	})
+}
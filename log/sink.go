@@ -0,0 +1,335 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Sink describes one destination for a logger's output. A logger created with
+// Config.Sinks writes every event to each sink whose Level allows it, so the
+// same call can end up as JSON in a file and as plain text on stdout.
+//
+// The zero Level is LevelFatal and the zero Flags is FlagsNone, so build sinks
+// with NewSink to start from the package defaults.
+type Sink struct {
+	// Output is where the sink writes. Nil uses the package default output.
+	Output io.Writer
+	// Format is sanitized the same way as Config.Format.
+	Format LogFormat
+	// Level is the most verbose level written to this sink.
+	Level LogLevel
+	// Flags are the stdlib log flags prefixed to PlainTextFormat lines, and
+	// passed on to Formatter.
+	Flags int
+	// Filter reports whether the field named key is written to this sink. The
+	// auto-fields golog_id, file and line are passed through it too. Nil keeps
+	// every field.
+	Filter func(key string) bool
+	// Where reports whether an event is written to this sink, on top of
+	// Level, e.g. the Match method of a query from the query package. It sees
+	// every field, including the sink's own and those Filter drops. Nil writes
+	// every event.
+	Where func(e Event) bool
+	// Formatter, when set, replaces Format. It writes the whole line, so the
+	// prefix and Flags are left to it, in Event.Flags.
+	Formatter Formatter
+}
+
+// NewSink returns a sink writing to w in the given format, using the package
+// default level and timestamp flags.
+func NewSink(w io.Writer, format LogFormat) Sink {
+	return Sink{
+		Output: w,
+		Format: format,
+		Level:  defaultLevel,
+		Flags:  defaultFlags,
+	}
+}
+
+// sink is the runtime counterpart of Sink, owned by a logger and guarded by
+// the logger's mutex.
+type sink struct {
+	level  LogLevel
+	filter func(key string) bool
+	where  func(e Event) bool
+
+	formatter Formatter
+	// opts are the logger's time format and field names, which the built-in
+	// formats follow.
+	opts formatOptions
+	// staticArgs are sink specific static fields, which the logger's own
+	// static fields override.
+	staticArgs []Field
+
+	// console sinks color their output when it's a terminal, and fall back to
+	// plain text otherwise. Colored output renders its own timestamp.
+	console bool
+	color   bool
+	// ownsLine is set for sinks whose formatter writes the whole line, without
+	// the stdlib logger's flags.
+	ownsLine bool
+
+	prefix string
+	flags  int
+	l      *log.Logger
+
+	// stamp, for sinks with a timestamp of their own, writes it where the
+	// stdlib logger writes its own. stampMu keeps concurrent events from
+	// swapping stamps.
+	stamp   *stampWriter
+	stampMu sync.Mutex
+}
+
+func newSink(conf Sink, opts formatOptions) *sink {
+	opts.stdlibHeader = true
+	sk := &sink{
+		level:  conf.Level,
+		filter: conf.Filter,
+		where:  conf.Where,
+		opts:   opts,
+	}
+
+	switch format := SanitizeFormat(conf.Format); {
+	case conf.Formatter != nil:
+		sk.formatter = conf.Formatter
+		sk.flags = conf.Flags
+		sk.ownsLine = true
+	case registeredFormat(format) != nil:
+		sk.formatter = registeredFormat(format)
+		sk.flags = conf.Flags
+		sk.ownsLine = true
+	case format == JsonFormat:
+		sk.formatter = FormatterFunc(opts.formatLogEventAsJson)
+
+		// Don't mess up the json by letting logger print the prefix or flags,
+		// put the prefix into the fields instead.
+		if defaultPrefix != "" {
+			sk.staticArgs = []Field{{"prefix", defaultPrefix}}
+		}
+	case format == KeyValueFormat:
+		sk.formatter = FormatterFunc(opts.formatLogEventAsKeyValue)
+	case format == LogfmtFormat:
+		sk.formatter = FormatterFunc(opts.formatLogEventAsLogfmt)
+
+		// As with json, keep the line parseable by sending the prefix as a field.
+		if defaultPrefix != "" {
+			sk.staticArgs = []Field{{"prefix", defaultPrefix}}
+		}
+	case format == EcsFormat:
+		sk.formatter = FormatterFunc(formatLogEventAsEcs)
+
+		// As with json, the prefix ends up as a label.
+		if defaultPrefix != "" {
+			sk.staticArgs = []Field{{"prefix", defaultPrefix}}
+		}
+	case format == CloudLoggingFormat:
+		sk.formatter = cloudLoggingFormatter(os.Getenv("GOOGLE_CLOUD_PROJECT"))
+
+		// As with json, the prefix ends up as a label.
+		if defaultPrefix != "" {
+			sk.staticArgs = []Field{{"prefix", defaultPrefix}}
+		}
+	case format == PrettyFormat:
+		sk.formatter = FormatterFunc(opts.formatLogEventAsPretty)
+		sk.prefix = defaultPrefix
+		sk.flags = conf.Flags
+	case format == TemplateFormat:
+		// The template writes the timestamp itself, but leaves the prefix.
+		sk.formatter = opts.templateFormatter()
+		sk.prefix = defaultPrefix
+		sk.flags = conf.Flags
+		sk.ownsLine = true
+	case format == ConsoleFormat:
+		sk.console = true
+		sk.prefix = defaultPrefix
+		sk.flags = conf.Flags
+	default:
+		sk.formatter = FormatterFunc(opts.formatLogEventAsPlainText)
+		sk.prefix = defaultPrefix
+		sk.flags = conf.Flags
+	}
+
+	output := conf.Output
+	if output == nil {
+		output = defaultOutput
+	}
+	sk.setOutput(output)
+
+	return sk
+}
+
+// setOutput points the sink at w, choosing between colors and plain text for
+// console sinks.
+func (sk *sink) setOutput(w io.Writer) {
+	if sk.console {
+		sk.color = colorEnabled(w)
+		if sk.color {
+			sk.formatter = FormatterFunc(sk.opts.formatLogEventAsConsole)
+		} else {
+			sk.formatter = FormatterFunc(sk.opts.formatLogEventAsPlainText)
+		}
+	}
+	sk.stamp = nil
+	if sk.opts.ownsTimestamp() && !sk.color && !sk.ownsLine {
+		sk.stamp = &stampWriter{w: w}
+		w = sk.stamp
+	}
+	sk.l = log.New(w, sk.prefix, sk.loggerFlags())
+}
+
+// loggerFlags are the flags for the stdlib logger, which leaves timestamps to
+// colored console output and custom formatters.
+func (sk *sink) loggerFlags() int {
+	if sk.color || sk.ownsLine {
+		return FlagsNone
+	}
+	return sk.flags
+}
+
+// stampWriter replaces the timestamp the stdlib logger writes in each line with
+// the sink's, in the logger's clock and time format, so that the line keeps the
+// layout the flags give it.
+type stampWriter struct {
+	w io.Writer
+	// at and n locate the stdlib logger's timestamp in the next line, and
+	// stamp replaces it.
+	at, n int
+	stamp string
+}
+
+func (sw *stampWriter) Write(p []byte) (int, error) {
+	if sw.n == 0 || sw.at+sw.n > len(p) {
+		return sw.w.Write(p)
+	}
+
+	line := make([]byte, 0, len(p)-sw.n+len(sw.stamp))
+	line = append(line, p[:sw.at]...)
+	line = append(line, sw.stamp...)
+	line = append(line, p[sw.at+sw.n:]...)
+	if _, err := sw.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stdlibTimestampLen is the length of the date and time the stdlib logger
+// writes for flags, with the space after each.
+func stdlibTimestampLen(flags int) int {
+	n := 0
+	if flags&FlagsDate != 0 {
+		n += len("2006/01/02 ")
+	}
+	if flags&FlagsPrecisionTime != 0 {
+		n += len("15:04:05.000000 ")
+	} else if flags&FlagsTime != 0 {
+		n += len("15:04:05 ")
+	}
+	return n
+}
+
+// log formats and writes a single event, unless the sink's level excludes it.
+// e.KeysAndValues must have an even length.
+func (sk *sink) log(level LogLevel, e Event) {
+	if level > sk.level {
+		return
+	}
+
+	staticFields, keysAndValues := e.StaticFields, e.KeysAndValues
+
+	if len(sk.staticArgs) > 0 {
+		merged := sk.staticArgs
+		for _, f := range staticFields {
+			merged = withField(merged, f.Key, f.Value)
+		}
+		staticFields = merged
+	}
+
+	if sk.where != nil {
+		e.StaticFields = staticFields
+		if !sk.where(e) {
+			return
+		}
+	}
+
+	if sk.filter != nil {
+		filteredStatic := make([]Field, 0, len(staticFields))
+		for _, f := range staticFields {
+			if sk.filter(f.Key) {
+				filteredStatic = append(filteredStatic, f)
+			}
+		}
+		staticFields = filteredStatic
+
+		filtered := make([]any, 0, len(keysAndValues))
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			if sk.filter(fmt.Sprintf("%v", keysAndValues[i])) {
+				filtered = append(filtered, keysAndValues[i], keysAndValues[i+1])
+			}
+		}
+		keysAndValues = filtered
+	}
+
+	e.StaticFields, e.KeysAndValues, e.Flags = staticFields, keysAndValues, sk.flags
+	if sk.stamp != nil {
+		sk.stampMu.Lock()
+		defer sk.stampMu.Unlock()
+		sk.stamp.at, sk.stamp.n, sk.stamp.stamp = 0, stdlibTimestampLen(sk.flags), ""
+		if sk.stamp.n > 0 {
+			if sk.flags&log.Lmsgprefix == 0 {
+				sk.stamp.at = len(sk.prefix)
+			}
+			sk.stamp.stamp = sk.opts.textTimestamp(sk.flags, e.Time) + " "
+		}
+	}
+	sk.l.Println(sk.formatter.Format(e))
+}
+
+// eventFields merges static fields and call-site key/values into a single list:
+// static fields first, then call-site fields, each in the order given.
+// Call-site fields override static fields with the same key.
+func eventFields(staticFields []Field, args []any) []Field {
+	fields := make([]Field, 0, len(staticFields)+len(args)/2)
+	argKeys := make(map[string]bool, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		argKeys[fmt.Sprintf("%v", args[i])] = true
+	}
+
+	for _, f := range staticFields {
+		if !argKeys[f.Key] {
+			fields = append(fields, f)
+		}
+	}
+
+	for i := 0; i+1 < len(args); i += 2 {
+		fields = append(fields, Field{fmt.Sprintf("%v", args[i]), fmt.Sprintf("%v", args[i+1])})
+	}
+	return fields
+}
+
+// withField returns a copy of fields with the field named key set to value, in
+// place if there's one already, or last. fields itself is left untouched, as
+// events logged earlier may still hold it.
+func withField(fields []Field, key, value string) []Field {
+	updated := make([]Field, len(fields), len(fields)+1)
+	copy(updated, fields)
+	for i, f := range updated {
+		if f.Key == key {
+			updated[i].Value = value
+			return updated
+		}
+	}
+	return append(updated, Field{key, value})
+}
+
+// popField removes the first field named key, returning its value.
+func popField(fields []Field, key string) (string, []Field) {
+	for i, f := range fields {
+		if f.Key == key {
+			return f.Value, append(fields[:i:i], fields[i+1:]...)
+		}
+	}
+	return "", fields
+}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSinks(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("writes each sink in its own format and level", func(t *testing.T) {
+		resetLogging(t)
+		jsonOutput := new(bytes.Buffer)
+		textOutput := new(bytes.Buffer)
+		jsonSink := NewSink(jsonOutput, JsonFormat)
+		jsonSink.Level = LevelError
+		textSink := NewSink(textOutput, PlainTextFormat)
+		textSink.Level = LevelInfo
+
+		logger := New(Config{ID: "id", Sinks: []Sink{jsonSink, textSink}})
+		logger.Error("oh no", "key", "value")
+		logger.Info("fine")
+		logger.Debug("hidden")
+
+		var entry jsonLogEntry
+		if err := json.Unmarshal(jsonOutput.Bytes(), &entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if entry.Message != "oh no" {
+			t.Errorf("got %q, want %q", entry.Message, "oh no")
+		}
+		if entry.Fields["golog_id"] != "id" || entry.Fields["key"] != "value" {
+			t.Errorf("unexpected fields %v", entry.Fields)
+		}
+
+		want := "ERROR | id | oh no | key='value'\nINFO | id | fine\n"
+		if got := textOutput.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("uses sink flags for plain text", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		sink := NewSink(output, PlainTextFormat)
+		sink.Flags = FlagsDate
+
+		New(Config{Sinks: []Sink{sink}}).Info("msg")
+
+		if !strings.HasPrefix(output.String(), time.Now().Format("2006/01/02")) {
+			t.Errorf("output %q does not start with date prefix", output.String())
+		}
+	})
+
+	t.Run("filters fields per sink", func(t *testing.T) {
+		resetLogging(t)
+		filteredOutput := new(bytes.Buffer)
+		fullOutput := new(bytes.Buffer)
+		filtered := NewSink(filteredOutput, PlainTextFormat)
+		filtered.Filter = func(key string) bool { return key != "secret" }
+
+		logger := New(Config{Sinks: []Sink{filtered, NewSink(fullOutput, PlainTextFormat)}}, "secret", "static")
+		logger.Info("msg", "secret", "hunter2", "user", "bilbo")
+
+		if got := filteredOutput.String(); got != "INFO | msg | user='bilbo'\n" {
+			t.Errorf("got %q", got)
+		}
+		if got := fullOutput.String(); got != "INFO | msg | secret='hunter2' user='bilbo'\n" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("filters events per sink", func(t *testing.T) {
+		resetLogging(t)
+		whereOutput := new(bytes.Buffer)
+		where := NewSink(whereOutput, PlainTextFormat)
+		where.Filter = func(key string) bool { return key != "user" }
+		where.Where = func(e Event) bool {
+			// Fields the sink filters out still count.
+			user, _ := popField(e.Fields(), "user")
+			return user == "bilbo"
+		}
+
+		logger := New(Config{Sinks: []Sink{where}})
+		logger.Info("first", "user", "bilbo")
+		logger.Info("second", "user", "frodo")
+
+		if got := whereOutput.String(); got != "INFO | first\n" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("does not let one sink alter the fields seen by another", func(t *testing.T) {
+		resetLogging(t)
+		first := new(bytes.Buffer)
+		second := new(bytes.Buffer)
+		SetOutput(new(bytes.Buffer))
+		DefaultLogger = New(Config{Sinks: []Sink{NewSink(first, PlainTextFormat), NewSink(second, PlainTextFormat)}})
+
+		Info("id", "msg", "key", "value")
+
+		want := "INFO | id | msg | key='value'\n"
+		if first.String() != want || second.String() != want {
+			t.Errorf("got %q and %q, want %q", first.String(), second.String(), want)
+		}
+	})
+
+	t.Run("logger level caps every sink", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		sink := NewSink(output, PlainTextFormat)
+		sink.Level = LevelTrace
+
+		logger := New(Config{Sinks: []Sink{sink}})
+		logger.SetLevel(LevelWarn)
+		logger.Info("hidden")
+
+		if output.Len() != 0 {
+			t.Errorf("expected empty output, got %q", output.String())
+		}
+	})
+
+	t.Run("SetOutput redirects every sink", func(t *testing.T) {
+		resetLogging(t)
+		logger := New(Config{Sinks: []Sink{
+			NewSink(new(bytes.Buffer), PlainTextFormat),
+			NewSink(new(bytes.Buffer), KeyValueFormat),
+		}})
+		output := new(bytes.Buffer)
+		logger.SetOutput(output)
+
+		logger.Info("msg")
+
+		if got := strings.Count(output.String(), "\n"); got != 2 {
+			t.Errorf("got %d lines, want 2: %q", got, output.String())
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogProtocol selects the syslog message format.
+type SyslogProtocol int
+
+const (
+	SyslogRFC5424 SyslogProtocol = iota
+	SyslogRFC3164
+)
+
+// SyslogFacility is a syslog facility code.
+type SyslogFacility int
+
+const (
+	SyslogFacilityUser   SyslogFacility = 1
+	SyslogFacilityDaemon SyslogFacility = 3
+	SyslogFacilityLocal0 SyslogFacility = 16
+	SyslogFacilityLocal1 SyslogFacility = 17
+	SyslogFacilityLocal2 SyslogFacility = 18
+	SyslogFacilityLocal3 SyslogFacility = 19
+	SyslogFacilityLocal4 SyslogFacility = 20
+	SyslogFacilityLocal5 SyslogFacility = 21
+	SyslogFacilityLocal6 SyslogFacility = 22
+	SyslogFacilityLocal7 SyslogFacility = 23
+)
+
+// syslogSeverities maps levels to syslog severities. TRACE has no syslog
+// equivalent, so it shares DEBUG's.
+var syslogSeverities = map[LogLevelName]int{
+	LevelFatalName: 2, // critical
+	LevelErrorName: 3, // error
+	LevelWarnName:  4, // warning
+	LevelInfoName:  6, // informational
+	LevelDebugName: 7, // debug
+	LevelTraceName: 7, // debug
+}
+
+// syslogStructuredDataID is the default SD-ID, using the enterprise number
+// reserved for documentation by RFC 5612.
+const syslogStructuredDataID = "golog@32473"
+
+// SyslogConfig - syslog sink config. Default/unset values for each attribute
+// are safe, except Network and Address.
+type SyslogConfig struct {
+	// Network is "udp", "tcp" or "unixgram".
+	Network string
+	// Address is host:port for udp and tcp, or a socket path for unixgram, e.g.
+	// /dev/log.
+	Address string
+
+	Protocol SyslogProtocol
+	// Facility defaults to SyslogFacilityUser.
+	Facility SyslogFacility
+	// Hostname defaults to os.Hostname().
+	Hostname string
+	// AppName defaults to the golog_id of each event, or the program name for
+	// events without one.
+	AppName string
+	// StructuredDataID is the RFC 5424 SD-ID key/values are sent under.
+	// Defaults to golog@32473.
+	StructuredDataID string
+}
+
+// NewSyslogSink returns a sink sending each event as a syslog message. The
+// level maps to the syslog severity and the golog_id is sent as MSGID (and
+// APP-NAME, unless configured). With RFC 5424 the remaining key/values are
+// sent as structured data, with RFC 3164 they're appended to the message.
+func NewSyslogSink(conf SyslogConfig) (Sink, error) {
+	w, err := DialSyslog(conf.Network, conf.Address)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	if conf.Facility == 0 {
+		conf.Facility = SyslogFacilityUser
+	}
+	if conf.Hostname == "" {
+		conf.Hostname, _ = os.Hostname()
+	}
+	if conf.StructuredDataID == "" {
+		conf.StructuredDataID = syslogStructuredDataID
+	}
+
+	return Sink{
+		Output:    w,
+		Level:     defaultLevel,
+		Formatter: FormatterFunc(conf.format),
+	}, nil
+}
+
+func (conf SyslogConfig) format(e Event) string {
+	fields := e.Fields()
+	id, fields := popField(fields, "golog_id")
+
+	appName := conf.AppName
+	if appName == "" {
+		appName = id
+	}
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+
+	pri := int(conf.Facility)*8 + syslogSeverities[e.Level]
+	now := e.Time
+
+	if conf.Protocol == SyslogRFC3164 {
+		// There's no MSGID in RFC 3164, so keep the ID as a field unless it's
+		// already the tag.
+		if id != "" && id != appName {
+			fields = append([]Field{{"golog_id", id}}, fields...)
+		}
+
+		msg := fmt.Sprintf("<%d>%s %s %s[%d]: %s", pri, now.Format(time.Stamp),
+			syslogHeaderField(conf.Hostname, 255), syslogHeaderField(appName, 32), os.Getpid(), e.Message)
+		if len(fields) > 0 {
+			// Escaped as in PlainTextFormat, to keep each message on one line.
+			msg += " " + expandKeyValuePairs(fields)
+		}
+		return msg
+	}
+
+	structuredData := "-"
+	if len(fields) > 0 {
+		var sd strings.Builder
+		sd.WriteString("[" + conf.StructuredDataID)
+		for _, f := range fields {
+			fmt.Fprintf(&sd, ` %s="%s"`, syslogParamName(f.Key), syslogParamEscaper.Replace(f.Value))
+		}
+		sd.WriteString("]")
+		structuredData = sd.String()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s", pri, now.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(conf.Hostname, 255), syslogHeaderField(appName, 48), os.Getpid(),
+		syslogHeaderField(id, 32), structuredData, e.Message)
+}
+
+// syslogHeaderField makes s a valid header field: printable US-ASCII without
+// spaces, at most maxLen long, or "-" when empty.
+func syslogHeaderField(s string, maxLen int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < maxLen; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			b = append(b, c)
+		} else {
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// syslogParamName makes s a valid SD-PARAM name, which additionally excludes
+// '=', ']' and '"'.
+func syslogParamName(s string) string {
+	name := []byte(syslogHeaderField(s, 32))
+	for i, c := range name {
+		if c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// SyslogWriter is an io.WriteCloser sending each Write as one syslog message,
+// using octet-counted framing on stream connections. A failed write is retried
+// once on a fresh connection.
+type SyslogWriter struct {
+	network string
+	address string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+// DialSyslog connects to a syslog server. network is "udp", "tcp" or
+// "unixgram".
+func DialSyslog(network, address string) (*SyslogWriter, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unixgram":
+	default:
+		return nil, fmt.Errorf("golog: unsupported syslog network %q", network)
+	}
+
+	w := &SyslogWriter{network: network, address: address}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *SyslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write sends p, without its trailing newline, as a single message.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if strings.HasPrefix(w.network, "tcp") {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = w.conn.Write([]byte(msg)); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
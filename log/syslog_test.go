@@ -0,0 +1,198 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSyslogSink(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("sends RFC 5424 messages over udp", func(t *testing.T) {
+		resetLogging(t)
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer server.Close()
+
+		sink, err := NewSyslogSink(SyslogConfig{Network: "udp", Address: server.LocalAddr().String(), Hostname: "host"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer sink.Output.(*SyslogWriter).Close()
+
+		New(Config{ID: "db", Sinks: []Sink{sink}}, "region", "us").Error("oh no", "quote", `say "hi" [x]`)
+
+		got := readPacket(t, server)
+		pattern := `^<11>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) host db ` + strconv.Itoa(os.Getpid()) +
+			` db \[golog@32473 region="us" quote="say \\"hi\\" \[x\\]"\] oh no$`
+		if !regexp.MustCompile(pattern).MatchString(got) {
+			t.Errorf("got %q, want match for %q", got, pattern)
+		}
+	})
+
+	t.Run("maps levels to severities", func(t *testing.T) {
+		resetLogging(t)
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer server.Close()
+
+		sink, err := NewSyslogSink(SyslogConfig{Network: "udp", Address: server.LocalAddr().String(), Facility: SyslogFacilityLocal0})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sink.Level = LevelTrace
+		logger := New(Config{Sinks: []Sink{sink}})
+
+		captureExit(t)
+		for _, tc := range []struct {
+			log  func(string, ...any)
+			want string
+		}{
+			{logger.Fatal, "<130>1 "},
+			{logger.Error, "<131>1 "},
+			{logger.Warn, "<132>1 "},
+			{logger.Info, "<134>1 "},
+			{logger.Debug, "<135>1 "},
+			{logger.Trace, "<135>1 "},
+		} {
+			tc.log("msg")
+			if got := readPacket(t, server); !strings.HasPrefix(got, tc.want) {
+				t.Errorf("got %q, want prefix %q", got, tc.want)
+			}
+		}
+	})
+
+	t.Run("sends RFC 3164 messages", func(t *testing.T) {
+		resetLogging(t)
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer server.Close()
+
+		sink, err := NewSyslogSink(SyslogConfig{
+			Network:  "udp",
+			Address:  server.LocalAddr().String(),
+			Protocol: SyslogRFC3164,
+			Hostname: "host",
+			AppName:  "app",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		New(Config{ID: "db", Sinks: []Sink{sink}}).Warn("slow", "ms", 200, "user name", "it's\nme")
+
+		got := readPacket(t, server)
+		pattern := `^<12>\w{3} [ \d]\d \d\d:\d\d:\d\d host app\[\d+\]: slow golog_id='db' ms='200' user_name='it\\'s\\nme'$`
+		if !regexp.MustCompile(pattern).MatchString(got) {
+			t.Errorf("got %q, want match for %q", got, pattern)
+		}
+	})
+
+	t.Run("uses octet counting over tcp and reconnects", func(t *testing.T) {
+		resetLogging(t)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer listener.Close()
+
+		sink, err := NewSyslogSink(SyslogConfig{Network: "tcp", Address: listener.Addr().String()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger := New(Config{Sinks: []Sink{sink}})
+
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		logger.Info("first")
+		r := bufio.NewReader(conn)
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasSuffix(string(msg), " - - first") {
+			t.Errorf("got %q", msg)
+		}
+		conn.Close()
+
+		// The first writes after the server hung up may still succeed, so keep
+		// logging until the writer notices and reconnects.
+		accepted := make(chan net.Conn)
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				accepted <- conn
+			}
+		}()
+		deadline := time.After(5 * time.Second)
+		for {
+			logger.Info("again")
+			select {
+			case conn := <-accepted:
+				conn.Close()
+				return
+			case <-deadline:
+				t.Fatal("writer did not reconnect")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+
+	t.Run("sends over unix datagram sockets", func(t *testing.T) {
+		resetLogging(t)
+		path := filepath.Join(t.TempDir(), "log.sock")
+		server, err := net.ListenPacket("unixgram", path)
+		if err != nil {
+			t.Skipf("unixgram not supported: %v", err)
+		}
+		defer server.Close()
+
+		sink, err := NewSyslogSink(SyslogConfig{Network: "unixgram", Address: path})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		New(Config{Sinks: []Sink{sink}}).Info("hello")
+
+		if got := readPacket(t, server); !strings.HasSuffix(got, " - - hello") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("rejects unsupported networks", func(t *testing.T) {
+		if _, err := NewSyslogSink(SyslogConfig{Network: "carrier-pigeon"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
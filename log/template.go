@@ -0,0 +1,201 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate is the TemplateFormat layout used when neither
+// Config.Template nor LOG_TEMPLATE is set. It mirrors PlainTextFormat, with the
+// level padded so that descriptions line up.
+const DefaultTemplate = `{{with timestamp .}}{{.}} | {{end}}{{pad 5 .Level}} | ` +
+	`{{with field "golog_id" .}}{{escape .}} | {{end}}{{escape .Message}}` +
+	`{{with except .Fields "golog_id"}} | {{pairs .}}{{end}}`
+
+// NewTemplateFormatter compiles text into a formatter, as TemplateFormat does
+// with Config.Template, returning an error if it doesn't parse or fails to
+// execute against a sample event.
+//
+// The template is executed with the Event, and these functions besides the
+// text/template builtins:
+//
+//	pad n s          s padded with spaces to n characters, or right-aligned if n < 0
+//	upper s, lower s s in upper or lower case
+//	color name s     s in an ANSI color: bold, dim, red, green, yellow, blue, magenta or cyan
+//	levelColor l s   s in the color console output uses for level l
+//	timestamp e      e's time as the text formats write it, following Config.TimeFormat or the sink's flags
+//	formatTime f t   t in the time.Format layout or TimeFormatEpoch unit f
+//	field key e      the value of e's field named key, or ""
+//	except fs keys   the fields fs, without those named keys
+//	pairs fs         fs as k='v' pairs, escaped as PlainTextFormat does
+//	logfmt fs        fs as logfmt pairs
+//	escape s         s escaped as a PlainTextFormat segment
+//
+// Nothing is escaped unless the template asks for it, so use escape and pairs
+// to keep each event on a single line.
+func NewTemplateFormatter(text string) (Formatter, error) {
+	return formatOptions{}.newTemplateFormatter(text)
+}
+
+// compiledTemplate is a template parsed and tried out, or why it couldn't be.
+type compiledTemplate struct {
+	tmpl *template.Template
+	err  error
+	// warned is set once a sink has reported the error.
+	warned bool
+}
+
+var (
+	templatesMu sync.Mutex
+	// templates are compiled once per layout, however many loggers use them.
+	templates = make(map[string]*compiledTemplate)
+)
+
+// compileTemplate parses text and tries it out, once. The result is bound to
+// each sink's options with bindTemplate.
+func compileTemplate(text string) *compiledTemplate {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	if c, ok := templates[text]; ok {
+		return c
+	}
+
+	c := &compiledTemplate{}
+	c.tmpl, c.err = template.New("golog").Funcs(formatOptions{}.templateFuncs()).Parse(text)
+	if c.err == nil {
+		// Parsing doesn't catch fields or methods Event doesn't have, nor
+		// functions called with the wrong types, so try it out once.
+		sample := Event{
+			Time:          time.Now(),
+			Level:         LevelInfoName,
+			Message:       "sample",
+			StaticFields:  []Field{{"golog_id", "sample"}},
+			KeysAndValues: []any{"key", "value"},
+		}
+		c.err = c.tmpl.Execute(io.Discard, sample)
+	}
+	templates[text] = c
+	return c
+}
+
+func (o formatOptions) newTemplateFormatter(text string) (Formatter, error) {
+	c := compileTemplate(text)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return o.bindTemplate(c.tmpl)
+}
+
+// templateFormatter returns TemplateFormat's formatter, or DefaultTemplate's
+// if the configured template is invalid, warning about it on stderr once.
+func (o formatOptions) templateFormatter() Formatter {
+	formatter, err := o.newTemplateFormatter(o.template)
+	if err == nil {
+		return formatter
+	}
+	c := compileTemplate(o.template)
+	templatesMu.Lock()
+	if !c.warned {
+		c.warned = true
+		fmt.Fprintf(os.Stderr, "golog: invalid Config.Template, using the default template: %v\n", err)
+	}
+	templatesMu.Unlock()
+
+	formatter, _ = o.newTemplateFormatter(DefaultTemplate)
+	return formatter
+}
+
+// bindTemplate returns a formatter executing a copy of tmpl with functions
+// following o.
+func (o formatOptions) bindTemplate(tmpl *template.Template) (Formatter, error) {
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Funcs(o.templateFuncs())
+
+	return FormatterFunc(func(e Event) string {
+		var line strings.Builder
+		if err := tmpl.Execute(&line, e); err != nil {
+			// As with corrupt fields, keep the event rather than drop it.
+			e.KeysAndValues = append(e.KeysAndValues[:len(e.KeysAndValues):len(e.KeysAndValues)], "templateError", err.Error())
+			return o.formatLogEventAsPlainText(e)
+		}
+		return line.String()
+	}), nil
+}
+
+func (o formatOptions) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"pad": func(n int, s any) string {
+			return fmt.Sprintf("%*v", -n, s)
+		},
+		"upper": func(s any) string {
+			return strings.ToUpper(fmt.Sprintf("%v", s))
+		},
+		"lower": func(s any) string {
+			return strings.ToLower(fmt.Sprintf("%v", s))
+		},
+		"color": func(name string, s any) (string, error) {
+			code, ok := templateColors[name]
+			if !ok {
+				return "", fmt.Errorf("unknown color %q", name)
+			}
+			return fmt.Sprintf("%s%v%s", code, s, ansiReset), nil
+		},
+		"levelColor": func(level LogLevelName, s any) string {
+			return fmt.Sprintf("%s%v%s", levelColors[level], s, ansiReset)
+		},
+		"timestamp": func(e Event) string {
+			return o.textTimestamp(e.Flags, e.Time)
+		},
+		"formatTime": func(format string, t time.Time) string {
+			return formatOptions{timeFormat: format, timeLocation: o.timeLocation}.formatTime(t, "")
+		},
+		"field": func(key string, e Event) string {
+			value, _ := popField(e.Fields(), key)
+			return value
+		},
+		"except": func(fields []Field, keys ...string) []Field {
+			excluded := make(map[string]bool, len(keys))
+			for _, key := range keys {
+				excluded[key] = true
+			}
+			kept := make([]Field, 0, len(fields))
+			for _, f := range fields {
+				if !excluded[f.Key] {
+					kept = append(kept, f)
+				}
+			}
+			return kept
+		},
+		"pairs": expandKeyValuePairs,
+		"logfmt": func(fields []Field) string {
+			var line strings.Builder
+			for _, f := range fields {
+				writeLogfmtPair(&line, f.Key, f.Value)
+			}
+			return line.String()
+		},
+		"escape": func(s any) string {
+			return escapeTextSegment(fmt.Sprintf("%v", s))
+		},
+	}
+}
+
+var templateColors = map[string]string{
+	"bold":    ansiBold,
+	"dim":     ansiDim,
+	"red":     ansiRed,
+	"green":   ansiGreen,
+	"yellow":  ansiYellow,
+	"blue":    ansiBlue,
+	"magenta": ansiMagenta,
+	"cyan":    ansiCyan,
+}
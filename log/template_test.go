@@ -0,0 +1,146 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateFormat(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("defaults to a plain text layout", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		New(Config{Format: TemplateFormat, ID: "db"}, "static", "field").Info("Connected.\n", "host", "it's")
+
+		want := "INFO  | db | Connected.\\n | static='field' host='it\\'s'\n"
+		if got := output.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("renders the config template with helpers", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		New(Config{
+			Format:       TemplateFormat,
+			ID:           "db",
+			TimeLocation: time.UTC,
+			Template: `{{formatTime "epoch" .Time}} [{{pad -6 .Level}}] {{levelColor .Level (lower .Level)}} ` +
+				`{{color "cyan" (field "golog_id" .)}}: {{.Message}} {{logfmt (except .Fields "golog_id" "secret")}}`,
+		}).Warn("slow", "ms", 250, "secret", "hunter2", "q", "a b")
+
+		fields := strings.SplitN(output.String(), " ", 2)
+		if len(fields) != 2 || len(fields[0]) < 10 {
+			t.Fatalf("unexpected output %q", output.String())
+		}
+		want := "[  WARN] " + ansiYellow + "warn" + ansiReset + " " + ansiCyan + "db" + ansiReset + `: slow ms=250 q="a b"` + "\n"
+		if fields[1] != want {
+			t.Errorf("got %q, want %q", fields[1], want)
+		}
+	})
+
+	t.Run("writes the timestamp from the flags, after the prefix", func(t *testing.T) {
+		resetLogging(t)
+		SetPrefix("app ")
+		output := new(bytes.Buffer)
+		sink := NewSink(output, TemplateFormat)
+		sink.Flags = FlagsDate
+		New(Config{Sinks: []Sink{sink}, Template: `{{timestamp .}} {{.Message}}`}).Info("hello")
+
+		want := "app " + time.Now().Format("2006/01/02") + " hello\n"
+		if got := output.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("reads the template from the environment", func(t *testing.T) {
+		resetLogging(t)
+		t.Setenv("LOG_ENCODING", "template")
+		t.Setenv("LOG_TEMPLATE", "{{.Level}}: {{.Message}}")
+		initLogging()
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		Error("id", "oops")
+
+		if got := output.String(); got != "ERROR: oops\n" {
+			t.Errorf("got %q, want %q", got, "ERROR: oops\n")
+		}
+	})
+
+	t.Run("falls back to the default template for an invalid environment", func(t *testing.T) {
+		resetLogging(t)
+		t.Setenv("LOG_TEMPLATE", "{{.Nope}}")
+		initLogging()
+
+		if defaultTemplate != DefaultTemplate {
+			t.Errorf("got default template %q, want %q", defaultTemplate, DefaultTemplate)
+		}
+	})
+
+	t.Run("rejects invalid templates", func(t *testing.T) {
+		for _, text := range []string{
+			"{{.Message",
+			"{{nope .Message}}",
+			"{{.Nope}}",
+			`{{color "pink" .Message}}`,
+			"{{pad .Message .Level}}",
+		} {
+			if _, err := NewTemplateFormatter(text); err == nil {
+				t.Errorf("%q: expected an error", text)
+			}
+		}
+	})
+
+	t.Run("falls back to the default template for an invalid config", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+
+		// Loggers that don't use the template don't mind.
+		New(Config{Format: JsonFormat, Template: "{{.Nope}}", Sinks: []Sink{NewSink(output, JsonFormat)}}).Info("json")
+		New(Config{Template: "{{.Nope}}", Sinks: []Sink{{Output: output, Format: TemplateFormat, Level: LevelInfo}}}).Info("template")
+
+		lines := strings.Split(output.String(), "\n")
+		if !strings.HasPrefix(lines[0], "{") || !strings.HasPrefix(lines[1], "INFO  | template") {
+			t.Errorf("got %q, want json then the default template", lines)
+		}
+	})
+
+	t.Run("validates the config template", func(t *testing.T) {
+		if err := ValidateConfig(Config{Template: "{{.Nope}}"}); err == nil || !strings.Contains(err.Error(), "Config.Template") {
+			t.Errorf("got %v, want an invalid Config.Template error", err)
+		}
+		for _, conf := range []Config{{}, {Template: DefaultTemplate}, {Template: "{{.Level}}: {{.Message}}"}} {
+			if err := ValidateConfig(conf); err != nil {
+				t.Errorf("%q: unexpected error: %v", conf.Template, err)
+			}
+		}
+	})
+
+	t.Run("compiles each template once", func(t *testing.T) {
+		text := "{{.Level}} once"
+		New(Config{Template: text, Format: TemplateFormat})
+		compiled := compileTemplate(text)
+		New(Config{Template: text, Format: TemplateFormat})
+		SetPrefix("again")
+		if compileTemplate(text) != compiled {
+			t.Error("the template was compiled again")
+		}
+	})
+
+	t.Run("keeps events the template fails on", func(t *testing.T) {
+		formatter, err := NewTemplateFormatter(`{{index .KeysAndValues 1}}`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := formatter.Format(testEvent(0, LevelInfoName, "msg", nil))
+		if !strings.HasPrefix(got, "INFO | msg | templateError='") {
+			t.Errorf("got %q, want the plain text event with the error", got)
+		}
+	})
+}
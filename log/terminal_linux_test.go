@@ -0,0 +1,73 @@
+package log
+
+import (
+	"os"
+	"testing"
+)
+
+// openTerminal opens a pseudo terminal master, which answers terminal ioctls.
+func openTerminal(t *testing.T) *os.File {
+	t.Helper()
+	tty, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	t.Cleanup(func() { tty.Close() })
+	return tty
+}
+
+func TestIsTerminal(t *testing.T) {
+	t.Run("detects terminals", func(t *testing.T) {
+		if tty := openTerminal(t); !isTerminal(tty.Fd()) {
+			t.Error("expected a terminal")
+		}
+	})
+
+	t.Run("rejects pipes", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer r.Close()
+		defer w.Close()
+		if isTerminal(w.Fd()) {
+			t.Error("expected a pipe not to be a terminal")
+		}
+	})
+}
+
+func TestConsoleColors(t *testing.T) {
+	resetLogging(t)
+
+	t.Run("colors terminals", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "")
+		if !colorEnabled(openTerminal(t)) {
+			t.Error("expected colors")
+		}
+	})
+
+	t.Run("honors NO_COLOR", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "1")
+		if colorEnabled(openTerminal(t)) {
+			t.Error("expected no colors")
+		}
+	})
+
+	t.Run("switches on SetOutput", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "")
+		sk := newSink(Sink{Output: openTerminal(t), Format: ConsoleFormat, Flags: FlagsDefault}, formatOptions{})
+		if !sk.color || sk.l.Flags() != FlagsNone {
+			t.Errorf("got color %v and logger flags %d, want colors with the timestamp in the formatter", sk.color, sk.l.Flags())
+		}
+
+		_, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer w.Close()
+		sk.setOutput(w)
+		if sk.color || sk.l.Flags() != FlagsDefault {
+			t.Errorf("got color %v and logger flags %d after switching to a non-terminal", sk.color, sk.l.Flags())
+		}
+	})
+}
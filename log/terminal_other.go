@@ -0,0 +1,8 @@
+//go:build !linux
+
+package log
+
+// isTerminal reports false, as terminal detection is only supported on linux.
+func isTerminal(uintptr) bool {
+	return false
+}
@@ -0,0 +1,176 @@
+package log
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Special values for Config.TimeFormat, besides time.Format layouts.
+const (
+	TimeFormatRFC3339Nano  = time.RFC3339Nano
+	TimeFormatEpochSeconds = "epoch"
+	TimeFormatEpochMillis  = "epoch_millis"
+	TimeFormatEpochMicros  = "epoch_micros"
+)
+
+// DeterministicTime is when every event happens on a Config.Deterministic
+// logger without a Clock.
+var DeterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock tells a logger the time of each event.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// FixedClock returns a clock that's always at t.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// FieldNames renames the keys the json, key_value and logfmt formats write
+// every event with. Empty names keep each format's own.
+type FieldNames struct {
+	// Time replaces ts in json and logfmt, and timestamp in key_value.
+	Time string
+	// Level replaces lvl in json, and level in key_value and logfmt.
+	Level string
+	// Message replaces msg in json and logfmt, and message in key_value.
+	Message string
+	// ID replaces channel in key_value, and id in logfmt.
+	ID string
+	// Fields replaces fields in json.
+	Fields string
+}
+
+// formatOptions are the Config settings shared by the built-in formats.
+type formatOptions struct {
+	timeFormat   string
+	timeLocation *time.Location
+	names        FieldNames
+	// clock is Config.Clock, or the one set with SetClock. Nil is the system
+	// clock, which the stdlib logger's flags can follow.
+	clock Clock
+	// stdlibHeader is set for sinks, whose stdlib logger writes the header the
+	// flags ask for, timestamp included.
+	stdlibHeader bool
+	// template is TemplateFormat's layout: Config.Template, LOG_TEMPLATE or
+	// DefaultTemplate. It's only compiled for sinks that use it.
+	template string
+}
+
+func newFormatOptions(conf Config) formatOptions {
+	o := formatOptions{
+		timeFormat:   conf.TimeFormat,
+		timeLocation: conf.TimeLocation,
+		names:        conf.FieldNames,
+		clock:        conf.Clock,
+	}
+	if o.clock == nil {
+		o.clock = defaultClock
+	}
+	if o.clock == nil && conf.Deterministic {
+		o.clock = FixedClock(DeterministicTime)
+	}
+
+	o.template = conf.Template
+	if o.template == "" {
+		o.template = defaultTemplate
+	}
+	return o
+}
+
+// now is the time of a new event.
+func (o formatOptions) now() time.Time {
+	if o.clock == nil {
+		return time.Now()
+	}
+	return o.clock.Now()
+}
+
+// name returns the configured name for a key, or the format's own.
+func (o formatOptions) name(configured, own string) string {
+	if configured != "" {
+		return configured
+	}
+	return own
+}
+
+// formatTime renders t with the configured time format, or the format's own.
+// An empty format renders t with its String method, without the monotonic
+// clock reading.
+func (o formatOptions) formatTime(t time.Time, own string) string {
+	if o.timeLocation != nil {
+		t = t.In(o.timeLocation)
+	}
+
+	switch format := o.name(o.timeFormat, own); format {
+	case "":
+		return t.Round(0).String()
+	case TimeFormatEpochSeconds:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimeFormatEpochMillis:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case TimeFormatEpochMicros:
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	default:
+		return t.Format(format)
+	}
+}
+
+// ownsTimestamp reports whether the text formats render their timestamp
+// themselves, rather than leaving it to the stdlib logger's flags, which
+// support neither layouts, nor locations, nor clocks. Sinks still write it
+// where the stdlib logger would.
+func (o formatOptions) ownsTimestamp() bool {
+	return o.timeFormat != "" || o.timeLocation != nil || o.clock != nil
+}
+
+// ownTimestamp is the timestamp a text format writes as a segment of its own:
+// an owned timestamp with no stdlib logger to write it, or in a time format
+// that the flags don't ask for a timestamp in.
+func (o formatOptions) ownTimestamp(flags int, t time.Time) string {
+	if !o.ownsTimestamp() || o.stdlibHeader && stdlibTimestampLen(flags) > 0 {
+		return ""
+	}
+	return o.textTimestamp(flags, t)
+}
+
+// textTimestamp renders the timestamp text formats start with: t in the
+// configured time format, or as the stdlib logger would for flags.
+func (o formatOptions) textTimestamp(flags int, t time.Time) string {
+	if o.timeFormat != "" {
+		return o.formatTime(t, "")
+	}
+	if o.timeLocation != nil {
+		t = t.In(o.timeLocation)
+	}
+	return flagsTimestamp(flags, t)
+}
+
+// flagsTimestamp renders t the way the stdlib logger would for flags.
+func flagsTimestamp(flags int, t time.Time) string {
+	if flags&log.LUTC != 0 {
+		t = t.UTC()
+	}
+
+	var parts []string
+	if flags&FlagsDate != 0 {
+		parts = append(parts, t.Format("2006/01/02"))
+	}
+	if flags&FlagsPrecisionTime != 0 {
+		parts = append(parts, t.Format("15:04:05.000000"))
+	} else if flags&FlagsTime != 0 {
+		parts = append(parts, t.Format("15:04:05"))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,231 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestamps(t *testing.T) {
+	resetLogging(t)
+
+	now := time.Date(2014, 6, 1, 15, 4, 5, 123456789, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	t.Run("renders time formats", func(t *testing.T) {
+		for _, tt := range []struct {
+			opts formatOptions
+			own  string
+			want string
+		}{
+			{formatOptions{}, time.Kitchen, "3:04PM"},
+			{formatOptions{}, "", "2014-06-01 15:04:05.123456789 +0000 UTC"},
+			{formatOptions{timeFormat: TimeFormatRFC3339Nano}, TimeFormatEpochSeconds, "2014-06-01T15:04:05.123456789Z"},
+			{formatOptions{timeFormat: TimeFormatEpochSeconds}, "", "1401635045"},
+			{formatOptions{timeFormat: TimeFormatEpochMillis}, "", "1401635045123"},
+			{formatOptions{timeFormat: TimeFormatEpochMicros}, "", "1401635045123456"},
+			{formatOptions{timeFormat: "2006-01-02 15:04 MST", timeLocation: tokyo}, "", "2014-06-02 00:04 JST"},
+		} {
+			if got := tt.opts.formatTime(now, tt.own); got != tt.want {
+				t.Errorf("%+v: got %q, want %q", tt.opts, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("drops the monotonic clock reading", func(t *testing.T) {
+		if got := (formatOptions{}).formatTime(time.Now(), ""); strings.Contains(got, " m=") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("renders flags timestamps", func(t *testing.T) {
+		for flags, want := range map[int]string{
+			FlagsNone:                      "",
+			FlagsDefault:                   "2014/06/01 15:04:05",
+			FlagsTime | FlagsPrecisionTime: "15:04:05.123456",
+		} {
+			if got := flagsTimestamp(flags, now); got != want {
+				t.Errorf("flags %d: got %q, want %q", flags, got, want)
+			}
+		}
+		if got := (formatOptions{timeLocation: tokyo}).textTimestamp(FlagsTime, now); got != "00:04:05" {
+			t.Errorf("got %q, want the time in the location", got)
+		}
+	})
+
+	t.Run("applies to json", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		New(Config{
+			Format:       JsonFormat,
+			ID:           "id",
+			TimeFormat:   TimeFormatRFC3339Nano,
+			TimeLocation: time.UTC,
+			FieldNames:   FieldNames{Time: "@timestamp", Level: "level", Message: "message", Fields: "labels"},
+		}).Info("msg")
+
+		var entry map[string]any
+		if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, entry["@timestamp"].(string))
+		if err != nil || ts.Location() != time.UTC || time.Since(ts) > time.Minute {
+			t.Errorf("unexpected timestamp %v: %v", entry["@timestamp"], err)
+		}
+		if labels, _ := entry["labels"].(map[string]any); entry["level"] != "INFO" || entry["message"] != "msg" || labels["golog_id"] != "id" {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("applies to key_value", func(t *testing.T) {
+		opts := formatOptions{timeFormat: TimeFormatEpochMillis, names: FieldNames{Time: "ts", Level: "lvl", Message: "msg", ID: "logger"}}
+		before := time.Now().UnixMilli()
+		line := opts.formatLogEventAsKeyValue(testEvent(0, LevelInfoName, "hi", nil, "golog_id", "id", "k", "v"))
+
+		millis, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(strings.Fields(line)[0], "ts='"), "'"), 10, 64)
+		if err != nil || millis < before {
+			t.Errorf("unexpected timestamp in %q: %v", line, err)
+		}
+		if want := " lvl='INFO' logger='id' msg='hi' k='v'"; !strings.HasSuffix(line, want) {
+			t.Errorf("got %q, want suffix %q", line, want)
+		}
+	})
+
+	t.Run("applies to logfmt", func(t *testing.T) {
+		opts := formatOptions{timeFormat: TimeFormatEpochSeconds, names: FieldNames{Time: "time", Level: "severity", Message: "message", ID: "logger"}}
+		before := time.Now().Unix()
+		line := opts.formatLogEventAsLogfmt(testEvent(0, LevelWarnName, "hi", nil, "golog_id", "id"))
+
+		ts, rest, _ := strings.Cut(line, " ")
+		if seconds, err := strconv.ParseInt(strings.TrimPrefix(ts, "time="), 10, 64); err != nil || seconds < before {
+			t.Errorf("unexpected timestamp in %q: %v", line, err)
+		}
+		if want := "severity=warn logger=id message=hi"; rest != want {
+			t.Errorf("got %q, want %q", rest, want)
+		}
+	})
+
+	t.Run("replaces plain text flags", func(t *testing.T) {
+		resetLogging(t)
+		output := new(bytes.Buffer)
+		sink := NewSink(output, PlainTextFormat)
+		sink.Flags = FlagsDefault
+		logger := New(Config{Sinks: []Sink{sink}, TimeFormat: "2006-01-02", TimeLocation: time.UTC})
+		logger.Info("msg")
+
+		want := time.Now().UTC().Format("2006-01-02") + "  | INFO | msg\n"
+		if got := output.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+
+		output.Reset()
+		logger.SetTimestampFlags(FlagsDate | FlagsShortFile)
+		logger.Info("msg")
+		if got := output.String(); strings.Count(got, time.Now().UTC().Format("2006")) != 1 {
+			t.Errorf("got %q, want the date once", got)
+		}
+	})
+
+	t.Run("applies to colored console output", func(t *testing.T) {
+		opts := formatOptions{timeFormat: "2006"}
+		line := stripANSI(opts.formatLogEventAsConsole(testEvent(FlagsDefault, LevelInfoName, "msg", nil)))
+		if !strings.HasPrefix(line, time.Now().Format("2006")+" INFO ") {
+			t.Errorf("got %q, want the year then the level", line)
+		}
+	})
+}
+
+func TestClock(t *testing.T) {
+	resetLogging(t)
+
+	now := time.Date(2014, 6, 1, 15, 4, 5, 0, time.UTC)
+
+	t.Run("tells the time in every format", func(t *testing.T) {
+		for format, want := range map[LogFormat]string{
+			PlainTextFormat: "2014/06/01 15:04:05  | INFO | msg\n",
+			KeyValueFormat:  "timestamp='1401635045' level='INFO' channel='Golog' message='msg'\n",
+			JsonFormat:      `{"ts":"2014-06-01T15:04:05Z","lvl":"INFO","msg":"msg"}` + "\n",
+			LogfmtFormat:    "ts=2014-06-01T15:04:05.000Z level=info msg=msg\n",
+			TemplateFormat:  "2014/06/01 15:04:05 | INFO  | msg\n",
+		} {
+			resetLogging(t)
+			output := new(bytes.Buffer)
+			sink := NewSink(output, format)
+			sink.Flags = FlagsDefault
+			New(Config{Sinks: []Sink{sink}, Clock: FixedClock(now)}).Info("msg")
+
+			if got := output.String(); got != want {
+				t.Errorf("%s: got %q, want %q", format, got, want)
+			}
+		}
+	})
+
+	t.Run("keeps the layout of the flags", func(t *testing.T) {
+		digits := strings.NewReplacer("1", "0", "2", "0", "3", "0", "4", "0", "5", "0", "6", "0", "7", "0", "8", "0", "9", "0")
+		for _, flags := range []int{
+			FlagsDefault,
+			FlagsDate,
+			FlagsTime | FlagsPrecisionTime | log.LUTC,
+			FlagsDefault | FlagsShortFile,
+			FlagsDefault | FlagsLongFile | log.Lmsgprefix,
+			FlagsShortFile,
+		} {
+			for _, format := range []LogFormat{PlainTextFormat, PrettyFormat} {
+				resetLogging(t)
+				SetPrefix("app: ")
+				lines := make([]string, 2)
+				for i, clock := range []Clock{nil, FixedClock(now)} {
+					output := new(bytes.Buffer)
+					sink := NewSink(output, format)
+					sink.Flags = flags
+					New(Config{Sinks: []Sink{sink}, Clock: clock, ID: "id"}).Info("msg", "k", "v")
+					lines[i] = digits.Replace(output.String())
+				}
+				if lines[0] != lines[1] {
+					t.Errorf("%s, flags %d: got %q with a clock, want %q", format, flags, lines[1], lines[0])
+				}
+			}
+		}
+	})
+
+	t.Run("sets the clock of new loggers", func(t *testing.T) {
+		resetLogging(t)
+		SetClock(FixedClock(now))
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		SetTimestampFlags(FlagsDate)
+		Info("id", "msg")
+		New(Config{Clock: ClockFunc(func() time.Time { return now.AddDate(1, 0, 0) })}).Info("msg")
+
+		if got, want := output.String(), "2014/06/01  | INFO | id | msg\n2015/06/01  | INFO | msg\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+
+		SetClock(nil)
+		output.Reset()
+		New(Config{}).Info("msg")
+		if got := output.String(); !strings.HasPrefix(got, time.Now().Format("2006/01/")) {
+			t.Errorf("got %q, want the system clock back", got)
+		}
+	})
+
+	t.Run("makes output deterministic", func(t *testing.T) {
+		resetLogging(t)
+		SetStackTrace(true)
+		output := new(bytes.Buffer)
+		SetOutput(output)
+		logger := New(Config{Format: KeyValueFormat, ID: "id", Deterministic: true}, "z", 1, "b", 2)
+		logger.Info("msg", "y", 3, "a", 4)
+		logger.Info("msg", "y", 3, "a", 4)
+
+		line := "timestamp='946684800' level='INFO' channel='id' message='msg' a='4' b='2' y='3' z='1'\n"
+		if got := output.String(); got != line+line {
+			t.Errorf("got %q, want %q", got, line+line)
+		}
+	})
+}